@@ -0,0 +1,255 @@
+package lamport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Longest a /try request waits for the lock by default (see LockHandler)
+const TryWait = 10 * SleepTime
+
+// HTTP frontend for the lock, holding guards on behalf of its clients
+type lockAPI struct {
+	state *LamportLockState
+	lock  sync.Mutex
+	held  map[int]*clientGrant // grants by fencing token
+	turn  chan struct{}        // full while a client's request or grant is current
+}
+
+// Grant held on behalf of a client, released if its lease (if any) lapses
+type clientGrant struct {
+	guard *Guard
+	lease time.Duration
+	due   time.Time // lease lapses at (per the lock's Clock)
+}
+
+// HTTP handler exposing the lock to non-Go clients, with the endpoints:
+//   - POST acquire[?wait=<duration>][&lease=<duration>]: block until the
+//     lock is granted (or, with wait, for at most that long), replying with
+//     its fencing token
+//   - POST try[?wait=<duration>][&lease=<duration>]: as acquire, waiting at
+//     most TryWait by default
+//   - POST renew?token=<token>: renew the lease on the grant
+//   - POST release?token=<token>: release the grant with the given token
+//   - GET status[?token=<token>]: report the holder and health of the local
+//     process (and, with token, whether that grant is still held); status
+//     never renews a lease, so that monitoring cannot keep a dead client's
+//     grant alive
+//
+// A blocked acquire is abandoned if the client disconnects. A grant with a
+// lease is released once the client goes that long without renewing it, so
+// a crashed client does not leave the lock held. Clients of the same
+// handler take turns, as the process has a single request and grant at a
+// time: each waits for the previous client's grant to end before its own
+// request is sent. The handler serves a single lock: to expose several,
+// mount one handler per lock under its own prefix (see http.StripPrefix).
+func (state *LamportLockState) LockHandler() http.Handler {
+	api := &lockAPI{state: state, held: make(map[int]*clientGrant), turn: make(chan struct{}, 1)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/acquire", func(w http.ResponseWriter, r *http.Request) {
+		api.acquire(w, r, 0)
+	})
+	mux.HandleFunc("/try", func(w http.ResponseWriter, r *http.Request) {
+		api.acquire(w, r, TryWait)
+	})
+	mux.HandleFunc("/renew", api.renew)
+	mux.HandleFunc("/release", api.release)
+	mux.HandleFunc("/status", api.status)
+	return mux
+}
+
+// Reply with v as JSON
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Reply with an error message as JSON
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// Acquire the lock for the client, waiting at most the requested (else
+// the default, if non-zero) time
+func (api *lockAPI) acquire(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("POST required"))
+		return
+	}
+	if s := r.URL.Query().Get("wait"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		wait = d
+	}
+	var lease time.Duration
+	if s := r.URL.Query().Get("lease"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		lease = d
+	}
+	ctx := r.Context()
+	if wait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wait)
+		defer cancel()
+	}
+
+	// wait for the previous local client's grant to end, then request the
+	// lock, keeping our turn until our own grant ends
+	var g *Guard
+	var err error
+	select {
+	case api.turn <- struct{}{}:
+		if g, err = api.state.AcquireContext(ctx); err != nil {
+			<-api.turn
+		}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusConflict, errors.New("lock not granted in time"))
+		return
+	} else if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	// hold the guard until released (or its lease lapses), forgetting it if
+	// the lock is lost
+	cg := &clientGrant{guard: g, lease: lease}
+	api.lock.Lock()
+	cg.due = api.state.opts.clock.Now().Add(lease)
+	api.held[g.Token()] = cg
+	api.lock.Unlock()
+	go func() {
+		if lease > 0 {
+			api.expire(cg)
+		}
+		<-g.Done()
+		api.lock.Lock()
+		delete(api.held, g.Token())
+		api.lock.Unlock()
+		<-api.turn
+	}()
+	writeJSON(w, http.StatusOK, map[string]int{"token": g.Token(), "proc": api.state.proc})
+}
+
+// Release the client's grant once its lease lapses, unless it ends first
+// Renewals only move the deadline: on waking, the remaining time is
+// re-checked and waited out.
+func (api *lockAPI) expire(cg *clientGrant) {
+	clock := api.state.opts.clock
+	for {
+		api.lock.Lock()
+		wait := cg.due.Sub(clock.Now())
+		api.lock.Unlock()
+		if wait <= 0 {
+			cg.guard.Release()
+			return
+		}
+		select {
+		case <-clock.After(wait):
+		case <-cg.guard.Done():
+			return
+		}
+	}
+}
+
+// Release the grant with the client's token
+func (api *lockAPI) release(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("POST required"))
+		return
+	}
+	token, err := strconv.Atoi(r.URL.Query().Get("token"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	api.lock.Lock()
+	cg, ok := api.held[token]
+	api.lock.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrNotHeld)
+		return
+	}
+	if err := cg.guard.Release(); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"token": token})
+}
+
+// Renew the lease on the grant with the given token, reporting whether it
+// is still held
+func (api *lockAPI) touch(token int) bool {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	cg, ok := api.held[token]
+	if ok && cg.lease > 0 {
+		cg.due = api.state.opts.clock.Now().Add(cg.lease)
+	}
+	return ok
+}
+
+// Report whether the grant with the given token is still held
+func (api *lockAPI) holds(token int) bool {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	_, ok := api.held[token]
+	return ok
+}
+
+// Renew the lease on the client's grant
+func (api *lockAPI) renew(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("POST required"))
+		return
+	}
+	token, err := strconv.Atoi(r.URL.Query().Get("token"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !api.touch(token) {
+		writeError(w, http.StatusNotFound, ErrNotHeld)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"token": token})
+}
+
+// Report the holder and health of the local process, and whether the
+// client's grant (if any) is still held
+func (api *lockAPI) status(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		Proc   int
+		Holder *HolderInfo `json:",omitempty"`
+		Health Health
+		Held   *bool `json:",omitempty"`
+	}{Proc: api.state.proc, Health: api.state.Health()}
+	if info, ok := api.state.Holder(); ok {
+		status.Holder = &info
+	}
+	if s := r.URL.Query().Get("token"); s != "" {
+		token, err := strconv.Atoi(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		held := api.holds(token)
+		status.Held = &held
+	}
+	writeJSON(w, http.StatusOK, status)
+}
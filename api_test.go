@@ -0,0 +1,163 @@
+package lamport
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// POST to the handler, failing the test on an unexpected reply
+func post(t *testing.T, h http.Handler, url string, want int) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, nil))
+	if w.Code != want {
+		t.Fatalf("POST %s: got %d (%s), want %d", url, w.Code, w.Body, want)
+	}
+	return w
+}
+
+// A renewed lease holds past its original deadline, then lapses a lease
+// after the renewal, all per the lock's Clock
+func TestLeaseRenewal(t *testing.T) {
+	clk := newFakeClock()
+	ls := NewLocalCluster(1, WithClock(clk))
+	defer stopAll(ls)
+	h := ls[0].LockHandler()
+
+	post(t, h, "/acquire?lease=1s", http.StatusOK)
+	g, ok := ls[0].heldGuard()
+	if !ok {
+		t.Fatal("lock not held after acquire")
+	}
+	token := strconv.Itoa(g.Token())
+	start := clk.Now()
+
+	clk.Advance(600 * time.Millisecond)
+	post(t, h, "/renew?token="+token, http.StatusOK)
+	clk.Advance(600 * time.Millisecond)
+	select {
+	case <-g.Done():
+		t.Fatal("renewed lease lapsed at its original deadline")
+	case <-time.After(50 * time.Millisecond):
+	}
+	post(t, h, "/renew?token="+token, http.StatusOK)
+	renewed := clk.Now()
+
+	waitFor(t, func() bool {
+		select {
+		case <-g.Done():
+			return true
+		default:
+			clk.Advance(10 * time.Millisecond)
+			return false
+		}
+	})
+	if lapsed := clk.Now().Sub(renewed); lapsed < time.Second || lapsed > 1500*time.Millisecond {
+		t.Errorf("lease lapsed %v after renewal, want about 1s", lapsed)
+	}
+	if clk.Now().Sub(start) < 2200*time.Millisecond {
+		t.Errorf("lease lapsed %v after acquire, before its renewed deadline", clk.Now().Sub(start))
+	}
+	waitFor(t, func() bool {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/renew?token="+token, nil))
+		return w.Code == http.StatusNotFound
+	})
+}
+
+// Fencing token granted in reply to an acquire
+func grantedToken(t *testing.T, w *httptest.ResponseRecorder) int {
+	t.Helper()
+	var reply struct{ Token int }
+	if err := json.NewDecoder(w.Body).Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply.Token
+}
+
+// Concurrent clients of one frontend hold the lock in turn, each with its
+// own grant
+func TestConcurrentClients(t *testing.T) {
+	ls := NewLocalCluster(2)
+	defer stopAll(ls)
+	h := ls[0].LockHandler()
+
+	res := make(chan *httptest.ResponseRecorder, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/acquire", nil))
+			res <- w
+		}()
+	}
+	var first *httptest.ResponseRecorder
+	select {
+	case first = <-res:
+	case <-time.After(5 * time.Second):
+		t.Fatal("neither client granted the lock")
+	}
+	if first.Code != http.StatusOK {
+		t.Fatalf("first client: got %d (%s)", first.Code, first.Body)
+	}
+	token := grantedToken(t, first)
+	select {
+	case w := <-res:
+		t.Fatalf("second client granted while the first holds the lock: %d (%s)", w.Code, w.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	post(t, h, "/release?token="+strconv.Itoa(token), http.StatusOK)
+	var second *httptest.ResponseRecorder
+	select {
+	case second = <-res:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second client not granted once the first released")
+	}
+	if second.Code != http.StatusOK {
+		t.Fatalf("second client: got %d (%s)", second.Code, second.Body)
+	}
+	next := grantedToken(t, second)
+	if next <= token {
+		t.Errorf("second client granted token %d after %d", next, token)
+	}
+	post(t, h, "/release?token="+strconv.Itoa(next), http.StatusOK)
+}
+
+// Checking on a grant through status does not renew its lease
+func TestStatusReadOnly(t *testing.T) {
+	clk := newFakeClock()
+	ls := NewLocalCluster(1, WithClock(clk))
+	defer stopAll(ls)
+	h := ls[0].LockHandler()
+
+	token := strconv.Itoa(grantedToken(t, post(t, h, "/acquire?lease=1s", http.StatusOK)))
+	g, ok := ls[0].heldGuard()
+	if !ok {
+		t.Fatal("lock not held after acquire")
+	}
+	start := clk.Now()
+	for i := 0; i < 3; i++ {
+		clk.Advance(300 * time.Millisecond)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status?token="+token, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status: got %d (%s)", w.Code, w.Body)
+		}
+	}
+	waitFor(t, func() bool {
+		select {
+		case <-g.Done():
+			return true
+		default:
+			clk.Advance(10 * time.Millisecond)
+			return false
+		}
+	})
+	if lapsed := clk.Now().Sub(start); lapsed > 1500*time.Millisecond {
+		t.Errorf("lease lapsed %v after acquire, despite status checks only", lapsed)
+	}
+}
@@ -0,0 +1,126 @@
+package lamport
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Kinds of audit record
+const (
+	AuditAcquire  = "acquire"  // the local process was granted the lock
+	AuditRelease  = "release"  // the local process released the lock
+	AuditTransfer = "transfer" // the local process handed the lock on
+	AuditLost     = "lost"     // the local process lost the lock (e.g. evicted)
+	AuditEvict    = "evict"    // a process was evicted (see ForceRelease)
+)
+
+// Entry in the audit trail of a process (see WithAudit)
+type AuditRecord struct {
+	Kind  string            // One of the Audit* kinds
+	Proc  int               // Process that held (or was evicted from) the lock
+	By    int               // Process that caused the event
+	Time  int               // Logical time of the event
+	Req   int               // Logical time of the granted request (acquisitions only)
+	Wall  time.Time         // Wall time of the event
+	Token int               // Fencing token of the grant (zero for evictions)
+	Held  time.Duration     // How long the grant lasted (zero for acquisitions)
+	Meta  map[string]string `json:",omitempty"` // Request metadata, if any
+}
+
+// Destination for audit records
+// Sinks are called in order from a single goroutine, so need not be
+// threadsafe unless shared between locks.
+type AuditSink interface {
+	Record(r AuditRecord) error
+}
+
+// Adapt a function into an audit sink
+type AuditFunc func(AuditRecord)
+
+// Pass r to the function
+func (fn AuditFunc) Record(r AuditRecord) error {
+	fn(r)
+	return nil
+}
+
+// Audit sink appending records to a file, one JSON object per line
+type FileAuditSink struct {
+	lock sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Open (or create) the audit file at path for appending
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Append r to the file, syncing it to stable storage
+func (s *FileAuditSink) Record(r AuditRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.enc.Encode(r); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close the audit file
+func (s *FileAuditSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
+
+// Start delivering audit records to the configured sinks, if any
+func (state *LamportLockState) startAudit() {
+	if len(state.opts.audit) == 0 {
+		return
+	}
+	state.audt = make(chan AuditRecord, LocalClusterBuffer)
+	state.adon = make(chan struct{})
+	go func(c chan AuditRecord) {
+		defer close(state.adon)
+		for r := range c {
+			for _, sink := range state.opts.audit {
+				if err := sink.Record(r); err != nil {
+					log.Printf("lamport: process %d failed to record audit event: %v",
+						state.proc, err)
+				}
+			}
+		}
+	}(state.audt)
+}
+
+// Flush outstanding audit records and stop delivery (threadsafe)
+func (state *LamportLockState) stopAudit() {
+	state.lock.Lock()
+	c := state.audt
+	state.audt = nil
+	state.lock.Unlock()
+	if c != nil {
+		close(c)
+		<-state.adon
+	}
+}
+
+// Queue an audit record for delivery, stamping it with the current time
+// Records are never dropped: if delivery falls behind, the lock stalls.
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) audit(r AuditRecord) {
+	if state.audt == nil {
+		return
+	}
+	r.Wall = state.opts.clock.Now()
+	if r.Time == 0 {
+		r.Time = state.time
+	}
+	state.audt <- r
+}
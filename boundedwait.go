@@ -0,0 +1,67 @@
+package lamport
+
+import "sort"
+
+// Acquisition that waited on more later requests than the bound allows
+// (see CheckBoundedWait)
+type WaitViolation struct {
+	Grant AuditRecord   // The overtaken acquisition
+	Ahead []AuditRecord // Acquisitions for later requests granted first, in grant order
+}
+
+// Check a trace of acquisitions against bounded waiting: no request may be
+// overtaken, i.e. granted after more than bound requests that followed it
+// in the total order, returning the violations in grant order
+// The trace is the audit records of every process (see WithAudit) in any
+// order; records of other kinds are ignored. Requests are ordered by
+// logical time, then process, and grants by fencing token.
+func CheckBoundedWait(records []AuditRecord, bound int) []WaitViolation {
+	var grants []AuditRecord
+	for _, r := range records {
+		if r.Kind == AuditAcquire {
+			grants = append(grants, r)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].Token < grants[j].Token })
+
+	// rank the requests in the total order
+	later := func(a, b AuditRecord) bool {
+		if a.Req != b.Req {
+			return a.Req > b.Req
+		}
+		return a.Proc > b.Proc
+	}
+	order := make([]int, len(grants))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return later(grants[order[j]], grants[order[i]]) })
+	rank := make([]int, len(grants))
+	for r, i := range order {
+		rank[i] = r + 1
+	}
+
+	// count, in grant order, the earlier grants ranked after each one (with
+	// a Fenwick tree over ranks), listing them only for violations
+	tree := make([]int, len(grants)+1)
+	var violations []WaitViolation
+	for i, g := range grants {
+		n := i
+		for r := rank[i]; r > 0; r -= r & -r {
+			n -= tree[r]
+		}
+		if n > bound {
+			v := WaitViolation{Grant: g}
+			for _, h := range grants[:i] {
+				if later(h, g) {
+					v.Ahead = append(v.Ahead, h)
+				}
+			}
+			violations = append(violations, v)
+		}
+		for r := rank[i]; r < len(tree); r += r & -r {
+			tree[r] += 1
+		}
+	}
+	return violations
+}
@@ -0,0 +1,27 @@
+package lamport
+
+import "time"
+
+// Source of time used for polling, timeouts, etc.
+// Compatible with fake clocks (e.g. github.com/benbjohnson/clock), allowing
+// the lock to be driven deterministically in tests.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+// Clock backed by the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
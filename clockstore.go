@@ -0,0 +1,53 @@
+package lamport
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// Key under which process p persists its clock (see WithClockStore)
+func clockKey(p int) string {
+	return fmt.Sprintf("clock-%d", p)
+}
+
+// Restore a bound on the timestamps issued before a restart, if a store is
+// configured, resuming the clock from there
+// Not threadsafe on its own: called only from initState
+func (state *LamportLockState) restoreClock() {
+	if state.opts.store == nil {
+		return
+	}
+	data, err := state.opts.store.Load(clockKey(state.proc))
+	if err == nil && data != nil {
+		state.ceil, err = strconv.Atoi(string(data))
+	}
+	if err != nil {
+		log.Printf("lamport: process %d failed to restore clock: %v", state.proc, err)
+		return
+	}
+	if state.ceil > state.time {
+		state.time = state.ceil
+	}
+}
+
+// Interceptor persisting a new bound on our timestamps before sending any
+// message beyond the last one saved, reserving margin ticks at a time
+// If saving fails, the message is sent regardless and the save is retried
+// on the next send.
+func (state *LamportLockState) reserveClock(next Handler) Handler {
+	return func(to int, m Message) {
+		state.clck.Lock()
+		if m.Time > state.ceil {
+			ceil := m.Time + state.opts.margin
+			err := state.opts.store.Save(clockKey(state.proc), []byte(strconv.Itoa(ceil)))
+			if err != nil {
+				log.Printf("lamport: process %d failed to persist clock: %v", state.proc, err)
+			} else {
+				state.ceil = ceil
+			}
+		}
+		state.clck.Unlock()
+		next(to, m)
+	}
+}
@@ -0,0 +1,27 @@
+package lamport
+
+// Minimum per-process channel buffer used by NewLocalCluster
+const LocalClusterBuffer = 512
+
+// Start n processes communicating over buffered channels, returning the
+// lock for each (indexed by process)
+// Buffers hold at least LocalClusterBuffer (and 4 per process) messages, so
+// that simultaneous Acquire() calls will not induce deadlock.
+func NewLocalCluster(n int, opts ...Option) []*LamportLockState {
+	// create input channel for each process
+	size := LocalClusterBuffer
+	if 4*n > size {
+		size = 4 * n
+	}
+	chns := make([]chan Message, n)
+	for p := range chns {
+		chns[p] = make(chan Message, size)
+	}
+
+	// start the processes
+	locks := make([]*LamportLockState, n)
+	for p := range locks {
+		locks[p] = Start(p, chns, opts...)
+	}
+	return locks
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Reply from the lock frontend (see lamport.LockHandler)
+type reply struct {
+	Token int
+	Error string
+	code  int // HTTP status (zero if there was no reply)
+}
+
+// POST (or GET) the given endpoint of the lock frontend, decoding the reply
+func call(base, method, endpoint string, query url.Values) (reply, error) {
+	var r reply
+	u := base + "/" + endpoint
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return r, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return r, err
+	}
+	defer resp.Body.Close()
+	r.code = resp.StatusCode
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return r, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return r, fmt.Errorf("%s: %s", endpoint, r.Error)
+	}
+	return r, nil
+}
+
+// Acquire the lock served at base, run the command under it and release
+// it, killing the command if the lock is lost or its lease cannot be
+// renewed in time; returns the command's exit status
+func run(base string, wait, poll, lease time.Duration, args []string) int {
+	// acquire (blocking, unless bounded by wait), leased so that the lock is
+	// released should we die without releasing it
+	query := url.Values{}
+	if wait > 0 {
+		query.Set("wait", wait.String())
+	}
+	if lease > 0 {
+		query.Set("lease", lease.String())
+	}
+	r, err := call(base, http.MethodPost, "acquire", query)
+	if err != nil {
+		log.Fatal("Error: acquire failed: ", err)
+	}
+	granted := time.Now()
+	token := url.Values{"token": {fmt.Sprint(r.Token)}}
+
+	// release on the way out, however the command ends (unless lost)
+	lost := false
+	defer func() {
+		if lost {
+			return
+		}
+		if _, err := call(base, http.MethodPost, "release", token); err != nil {
+			log.Println("Warning: release failed:", err)
+		}
+	}()
+
+	// start the command, passing on termination signals
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		log.Println("Error: cannot start command:", err)
+		return 127
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	// kill the command, should the lock no longer be ours
+	kill := func(why string) int {
+		log.Println("Error:", why+", killing command")
+		lost = true
+		cmd.Process.Kill()
+		<-exited
+		return 1
+	}
+
+	// the frontend releases the lock a lease after the last renewal to
+	// reach it, so count from when each successful renewal was sent (and
+	// until the first, from the grant: renewals start well within a lease)
+	var lapse <-chan time.Time
+	var timer *time.Timer
+	renewed := func(at time.Time) {
+		if lease <= 0 {
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.NewTimer(time.Until(at.Add(lease)))
+		lapse = timer.C
+	}
+	renewed(granted)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	// wait for the command, renewing the lease (which also checks that we
+	// still hold the lock)
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-exited:
+			var exit *exec.ExitError
+			if errors.As(err, &exit) {
+				return exit.ExitCode()
+			} else if err != nil {
+				log.Println("Error: command failed:", err)
+				return 1
+			}
+			return 0
+		case sig := <-sigs:
+			cmd.Process.Signal(sig)
+		case <-ticker.C:
+			sent := time.Now()
+			r, err := call(base, http.MethodPost, "renew", token)
+			if err == nil {
+				renewed(sent)
+			} else if r.code == http.StatusNotFound {
+				return kill("lock lost")
+			} else {
+				log.Println("Warning: renew failed:", err)
+			}
+		case <-lapse:
+			return kill("lease lapsed without renewal")
+		}
+	}
+}
+
+func main() {
+	// get the lock frontend and timing parameters
+	var base = flag.String("url", "http://localhost:8080", "URL of the lock frontend (see lamport.LockHandler)")
+	var wait = flag.Duration("wait", 0, "give up if the lock is not granted within this long (0 waits forever)")
+	var poll = flag.Duration("poll", time.Second, "interval between lease renewals (which check that the lock is still held)")
+	var lease = flag.Duration("lease", 10*time.Second, "have the frontend release the lock if not renewed for this long, killing the command should renewals fail for as long (0 never)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] command [args...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// check for a command
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// check parameters for sensible values
+	if *lease > 0 && *lease <= *poll {
+		log.Fatal("Error: lease must be longer than the poll interval")
+	}
+
+	// run the command under the lock
+	os.Exit(run(*base, *wait, *poll, *lease, flag.Args()))
+}
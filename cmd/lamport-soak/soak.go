@@ -0,0 +1,363 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/swfrench/lamport-go"
+)
+
+// Workload parameters
+type config struct {
+	n        int
+	duration time.Duration
+	hold     time.Duration
+	think    time.Duration
+	restart  time.Duration
+	report   time.Duration
+	bound    int
+	checks   bool
+}
+
+// Audited grants buffered before a bounded-wait check
+const settleBatch = 1024
+
+// Shared invariant-checking state
+type checker struct {
+	inside     int32 // processes currently in the critical section
+	lock       sync.Mutex
+	last       int // last fencing token granted
+	violations int64
+	acquires   []int64 // per process
+
+	// bounded-wait checking (see settle)
+	bound     int
+	pend      []lamport.AuditRecord // grants not yet checked
+	kept      []lamport.AuditRecord // checked grants that may still overtake others
+	seen      []int                 // last token audited, per process
+	reqs      []int                 // last request audited, per process
+	settled   int                   // grants up to this token are checked
+	overtaken int
+}
+
+// Audit sink collecting every process's grants for the bounded-wait check,
+// keeping only the fields it needs
+func (c *checker) record(r lamport.AuditRecord) {
+	if r.Kind != lamport.AuditAcquire {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pend = append(c.pend, lamport.AuditRecord{Kind: r.Kind, Proc: r.Proc, Req: r.Req, Token: r.Token})
+	c.seen[r.Proc], c.reqs[r.Proc] = r.Token, r.Req
+	if len(c.pend) >= settleBatch {
+		c.settle(false)
+	}
+}
+
+// Check the grants that can no longer be overtaken further, then forget
+// those that can no longer overtake any others (or all grants, if final)
+// Each process audits its grants in order, so once every process has
+// audited a later token, all grants up to the earliest of those are known.
+// Processes request in logical time order too, so no grant still to come
+// is for a request earlier than each process's first unchecked (or next)
+// one: checked grants for requests earlier than all of those cannot
+// overtake it.
+// Not threadsafe on its own: called only with lock held
+func (c *checker) settle(final bool) {
+	upto := math.MaxInt
+	if !final {
+		for _, t := range c.seen {
+			if t < upto {
+				upto = t
+			}
+		}
+	}
+	var ready, rest []lamport.AuditRecord
+	for _, r := range c.pend {
+		if r.Token <= upto {
+			ready = append(ready, r)
+		} else {
+			rest = append(rest, r)
+		}
+	}
+	c.pend = rest
+	if len(ready) == 0 {
+		return
+	}
+
+	// check the new grants, along with any earlier ones that may have
+	// overtaken them
+	c.kept = append(c.kept, ready...)
+	for _, v := range lamport.CheckBoundedWait(c.kept, c.bound) {
+		if v.Grant.Token > c.settled {
+			log.Printf("VIOLATION: process %d, request at %d, granted token %d after %d later requests",
+				v.Grant.Proc, v.Grant.Req, v.Grant.Token, len(v.Ahead))
+			c.overtaken += 1
+		}
+	}
+	c.settled = upto
+
+	// forget grants for requests earlier than any still to be checked
+	floor := math.MaxInt
+	for p, req := range c.reqs {
+		first := req + 1
+		for _, r := range c.pend {
+			if r.Proc == p {
+				first = r.Req
+				break
+			}
+		}
+		if first < floor {
+			floor = first
+		}
+	}
+	kept := c.kept[:0]
+	for _, r := range c.kept {
+		if r.Req >= floor {
+			kept = append(kept, r)
+		}
+	}
+	c.kept = kept
+}
+
+// Enter the critical section with the given grant, checking mutual
+// exclusion and that fencing tokens strictly increase
+func (c *checker) enter(p int, token int) {
+	if n := atomic.AddInt32(&c.inside, 1); n != 1 {
+		log.Printf("VIOLATION: %d processes in the critical section (entering: %d)", n, p)
+		atomic.AddInt64(&c.violations, 1)
+	}
+	c.lock.Lock()
+	if token <= c.last {
+		log.Printf("VIOLATION: process %d granted token %d after %d", p, token, c.last)
+		atomic.AddInt64(&c.violations, 1)
+	}
+	c.last = token
+	c.lock.Unlock()
+	atomic.AddInt64(&c.acquires[p], 1)
+}
+
+// Leave the critical section
+func (c *checker) leave() {
+	atomic.AddInt32(&c.inside, -1)
+}
+
+// Sleep for a random duration of up to d
+func pause(d time.Duration) {
+	if d > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(d))))
+	}
+}
+
+// Repeatedly acquire and release the lock as process p until stop is
+// closed, restarting the process every cfg.restart (if set)
+func worker(p int, chns []chan lamport.Message, cfg config, c *checker, stop <-chan struct{}, done chan<- lamport.Stats) {
+	var opts []lamport.Option
+	if cfg.checks {
+		opts = append(opts, lamport.WithInvariants())
+	}
+	if cfg.bound >= 0 {
+		opts = append(opts, lamport.WithAudit(lamport.AuditFunc(c.record)))
+	}
+	lock := lamport.Start(p, chns, opts...)
+	started := time.Now()
+	var stats lamport.Stats
+	for {
+		select {
+		case <-stop:
+			lock.Stop()
+			done <- merge(stats, lock.Stats())
+			return
+		default:
+		}
+
+		// acquire, check invariants while holding, release
+		guard, err := lock.Acquire()
+		if err != nil {
+			log.Fatal("Error: acquire failed: ", err)
+		}
+		c.enter(p, guard.Token())
+		pause(cfg.hold)
+		c.leave()
+		if err := guard.Release(); err != nil {
+			log.Fatal("Error: release failed: ", err)
+		}
+		pause(cfg.think)
+
+		// restart the process if due
+		if cfg.restart > 0 && time.Since(started) > cfg.restart {
+			lock.Stop()
+			stats = merge(stats, lock.Stats())
+			lock = lamport.Rejoin(p, chns, opts...)
+			started = time.Now()
+		}
+	}
+}
+
+// Combine the acquisition counts and latencies of successive incarnations
+// (percentiles are taken as the worse of the two)
+func merge(a, b lamport.Stats) lamport.Stats {
+	worse := func(x, y time.Duration) time.Duration {
+		if x > y {
+			return x
+		}
+		return y
+	}
+	return lamport.Stats{
+		Acquires: a.Acquires + b.Acquires,
+		AcquireLatency: lamport.Percentiles{
+			P50: worse(a.AcquireLatency.P50, b.AcquireLatency.P50),
+			P95: worse(a.AcquireLatency.P95, b.AcquireLatency.P95),
+			P99: worse(a.AcquireLatency.P99, b.AcquireLatency.P99),
+			Max: worse(a.AcquireLatency.Max, b.AcquireLatency.Max)}}
+}
+
+// Current heap in use, after a collection
+func heapInUse() uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return m.HeapInuse
+}
+
+// Run the soak test, returning whether it passed
+func soak(cfg config) bool {
+	baseGoroutines := runtime.NumGoroutine()
+
+	// set up channels large enough for the cluster (see NewLocalCluster)
+	size := lamport.LocalClusterBuffer
+	if 4*cfg.n > size {
+		size = 4 * cfg.n
+	}
+	chns := make([]chan lamport.Message, cfg.n)
+	for p := range chns {
+		chns[p] = make(chan lamport.Message, size)
+	}
+
+	// spawn workers
+	c := &checker{
+		acquires: make([]int64, cfg.n),
+		bound:    cfg.bound,
+		seen:     make([]int, cfg.n),
+		reqs:     make([]int, cfg.n)}
+	stop := make(chan struct{})
+	done := make(chan lamport.Stats, cfg.n)
+	for p := 0; p < cfg.n; p++ {
+		go worker(p, chns, cfg, c, stop, done)
+	}
+
+	// report progress until the duration is up, tracking heap growth
+	start := time.Now()
+	var firstHeap, lastHeap uint64
+	ticker := time.NewTicker(cfg.report)
+	deadline := time.After(cfg.duration)
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			lastHeap = heapInUse()
+			if firstHeap == 0 {
+				firstHeap = lastHeap
+			}
+			var total int64
+			for p := range c.acquires {
+				total += atomic.LoadInt64(&c.acquires[p])
+			}
+			log.Printf("%v: %d acquisitions, %d violations, %d goroutines, %d KiB heap",
+				time.Since(start).Round(time.Second), total, atomic.LoadInt64(&c.violations),
+				runtime.NumGoroutine(), lastHeap/1024)
+		case <-deadline:
+			break loop
+		}
+	}
+	ticker.Stop()
+
+	// stop the workers and collect their statistics
+	close(stop)
+	stats := make([]lamport.Stats, 0, cfg.n)
+	for p := 0; p < cfg.n; p++ {
+		stats = append(stats, <-done)
+	}
+	elapsed := time.Since(start)
+
+	// give stopped goroutines a moment to exit before checking for leaks
+	leaked := 0
+	for i := 0; i < 100; i++ {
+		if leaked = runtime.NumGoroutine() - baseGoroutines; leaked <= 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// final report
+	var total int64
+	for p := range c.acquires {
+		total += c.acquires[p]
+	}
+	fmt.Printf("duration:     %v\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("acquisitions: %d (%.1f/s)\n", total, float64(total)/elapsed.Seconds())
+	for p := range c.acquires {
+		fmt.Printf("  process %d: %d acquisitions\n", p, c.acquires[p])
+	}
+	var worst lamport.Stats
+	for _, s := range stats {
+		worst = merge(worst, s)
+	}
+	l := worst.AcquireLatency
+	fmt.Printf("wait (worst process): p50 %v, p95 %v, p99 %v, max %v\n", l.P50, l.P95, l.P99, l.Max)
+	fmt.Printf("violations:   %d\n", c.violations)
+	overtaken := 0
+	if cfg.bound >= 0 {
+		// every process has stopped, flushing its audit records
+		c.settle(true)
+		overtaken = c.overtaken
+		fmt.Printf("overtaken:    %d requests by more than %d\n", overtaken, cfg.bound)
+	}
+	fmt.Printf("goroutines:   %d leaked\n", leaked)
+	fmt.Printf("heap:         %d KiB at first report, %d KiB at last\n", firstHeap/1024, lastHeap/1024)
+
+	ok := c.violations == 0 && overtaken == 0 && leaked <= 0
+	if firstHeap > 0 && lastHeap > 2*firstHeap+(1<<20) {
+		fmt.Println("heap more than doubled: possible leak")
+		ok = false
+	}
+	return ok
+}
+
+func main() {
+	// get workload parameters
+	var cfg config
+	flag.IntVar(&cfg.n, "n", 4, "number of processes")
+	flag.DurationVar(&cfg.duration, "duration", time.Minute, "how long to run")
+	flag.DurationVar(&cfg.hold, "hold", time.Millisecond, "maximum (random) time to hold the lock")
+	flag.DurationVar(&cfg.think, "think", time.Millisecond, "maximum (random) time between acquisitions")
+	flag.DurationVar(&cfg.restart, "restart", 0, "restart each process (Stop, then Rejoin) this often (0 never)")
+	flag.DurationVar(&cfg.report, "report", 10*time.Second, "interval between progress reports")
+	flag.BoolVar(&cfg.checks, "invariants", true, "check each process's internal invariants (see lamport.WithInvariants)")
+	flag.IntVar(&cfg.bound, "bound", 0, "most later requests any request may be overtaken by (-1 skips the check)")
+	flag.Parse()
+
+	// check parameters for sensible values
+	if cfg.n < 2 {
+		log.Fatal("Error: nonsense number of processes ", cfg.n)
+	}
+	if cfg.report <= 0 || cfg.duration <= 0 {
+		log.Fatal("Error: duration and report interval must be positive")
+	}
+
+	// run the soak test
+	if !soak(cfg) {
+		fmt.Println("FAIL")
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/swfrench/lamport-go"
+)
+
+// Read the audit records in the named file (see lamport.FileAuditSink)
+func read(path string) ([]lamport.AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []lamport.AuditRecord
+	dec := json.NewDecoder(f)
+	for {
+		var r lamport.AuditRecord
+		if err := dec.Decode(&r); errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		records = append(records, r)
+	}
+}
+
+// Print a violation, with the grants that overtook the request
+func report(v lamport.WaitViolation) {
+	g := v.Grant
+	fmt.Printf("process %d, request at %d, granted token %d after %d later requests:\n",
+		g.Proc, g.Req, g.Token, len(v.Ahead))
+	for _, h := range v.Ahead {
+		fmt.Printf("  process %d, request at %d, granted token %d\n", h.Proc, h.Req, h.Token)
+	}
+}
+
+func main() {
+	// get the bound and the audit trails of every process
+	var bound = flag.Int("bound", 0, "most later requests any request may be overtaken by")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] audit-file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var records []lamport.AuditRecord
+	for _, path := range flag.Args() {
+		r, err := read(path)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		records = append(records, r...)
+	}
+
+	// check the merged trace
+	violations := lamport.CheckBoundedWait(records, *bound)
+	for _, v := range violations {
+		report(v)
+	}
+	if len(violations) > 0 {
+		fmt.Printf("FAIL: %d requests overtaken by more than %d\n", len(violations), *bound)
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+}
@@ -0,0 +1,24 @@
+package lamport
+
+// Cluster-wide monotonic counter shared by the processes of a lock
+// The count is a GuardedValue, so the same restrictions apply (exclusive
+// grants, one guarded value per lock).
+type Counter struct {
+	v *GuardedValue[int64]
+}
+
+// Create a distributed counter protected by the given lock
+func NewCounter(state *LamportLockState) *Counter {
+	return &Counter{v: NewGuardedValue[int64](state)}
+}
+
+// Increment the counter, returning the new value (starting from 1)
+// Values are unique across the cluster, e.g. for ID generation.
+func (c *Counter) Next() (int64, error) {
+	var n int64
+	err := c.v.Update(func(cur int64) int64 {
+		n = cur + 1
+		return n
+	})
+	return n, err
+}
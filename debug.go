@@ -0,0 +1,87 @@
+package lamport
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+)
+
+// Write a human-readable snapshot of the lock state to w, followed by the
+// stacks of all goroutines, for diagnosing a stuck process
+func (state *LamportLockState) DebugDump(w io.Writer) {
+	state.lock.Lock()
+	state.dump(w)
+	state.lock.Unlock()
+
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	fmt.Fprintf(w, "\ngoroutines:\n%s", buf)
+}
+
+// Write a debug dump (see DebugDump) to w on each of the given signals
+// (e.g. syscall.SIGUSR1), until the returned function is called
+func (state *LamportLockState) DumpOn(w io.Writer, sigs ...os.Signal) func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-c:
+				state.DebugDump(w)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// Write a human-readable snapshot of the lock state to w
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) dump(w io.Writer) {
+	fmt.Fprintf(w, "process %d: time %d, stopped %v\n", state.proc, state.time, state.stop)
+	fmt.Fprintf(w, "seen: %v\n", state.seen)
+	fmt.Fprintf(w, "gone: %v\n", state.gone)
+	fmt.Fprintf(w, "requests seen: %v (removed %d, ahead of ours %d)\n", state.reqn, state.rmvd, state.prio)
+	q := append([]Message(nil), *state.reqs...)
+	sort.Slice(q, func(i, j int) bool { return q[i].before(q[j]) })
+	fmt.Fprintf(w, "queue (%d):\n", len(q))
+	for _, req := range q {
+		fmt.Fprintf(w, "  process %d at %d", req.Proc, req.Time)
+		if req.Sess != "" {
+			fmt.Fprintf(w, ", session %q", req.Sess)
+		}
+		fmt.Fprintln(w)
+	}
+	if state.held != nil {
+		fmt.Fprintf(w, "held: token %d since %v\n", state.held.token, state.held.at)
+	} else {
+		fmt.Fprintln(w, "held: no")
+	}
+	if _, ok := state.ownRequest(); ok {
+		fmt.Fprintf(w, "acked: %v\n", state.ackd)
+	}
+	backlog := make([]int, len(state.chns))
+	for p, c := range state.chns {
+		backlog[p] = len(c)
+	}
+	fmt.Fprintf(w, "in flight (per destination): %v\n", backlog)
+	fmt.Fprintf(w, "service loop: last progress %v\n", state.last)
+	trace := state.Trace()
+	fmt.Fprintf(w, "recent events (%d):\n", len(trace))
+	writeTrace(w, "  ", trace)
+}
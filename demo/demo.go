@@ -2,77 +2,262 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/swfrench/lamport-go"
 	"log"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// Run the Lamport distributed lock demo for n communicating goroutines
-func demo(n int) {
-	// create input channel for each goroutine
-	chs := make([]chan lamport.Message, n)
-	for p := range chs {
-		chs[p] = make(chan lamport.Message, 512)
+// Contention profile for the demo
+type profile struct {
+	iters int           // acquisitions per worker
+	hold  time.Duration // mean critical section duration
+	dist  string        // distribution of critical section durations
+	think time.Duration // mean time between acquisitions
+	locks int           // number of independent locks
+}
+
+// Faults to inject into messages between workers
+type faults struct {
+	links   map[[2]int]bool // affected sender>receiver links (nil for all)
+	delay   time.Duration   // maximum (random) delivery delay
+	reorder bool            // deliver delayed messages asynchronously
+	drop    float64         // probability of dropping a message
+	dup     float64         // probability of duplicating a message
+}
+
+// Parse a list of sender>receiver links, e.g. "0>1,2>0"
+func parseLinks(s string) (map[[2]int]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	links := make(map[[2]int]bool)
+	for _, l := range strings.Split(s, ",") {
+		var from, to int
+		if _, err := fmt.Sscanf(l, "%d>%d", &from, &to); err != nil {
+			return nil, fmt.Errorf("bad link %q: %v", l, err)
+		}
+		links[[2]int{from, to}] = true
+	}
+	return links, nil
+}
+
+// Interceptor injecting the configured faults into outgoing messages
+// Note that the lock assumes reliable, in-order delivery: dropping,
+// duplicating or reordering messages can deadlock it or break mutual
+// exclusion, which the demo then reports. Delays alone (without reorder)
+// are safe, and only slow it down (see TestDemoDelay).
+func (f faults) inject(next lamport.Handler) lamport.Handler {
+	return func(to int, m lamport.Message) {
+		if f.links != nil && !f.links[[2]int{m.Proc, to}] {
+			next(to, m)
+			return
+		}
+		if rand.Float64() < f.drop {
+			log.Println("Fault: dropped message", m.Type, "from", m.Proc, "to", to)
+			return
+		}
+		copies := 1
+		if rand.Float64() < f.dup {
+			log.Println("Fault: duplicated message", m.Type, "from", m.Proc, "to", to)
+			copies = 2
+		}
+		for i := 0; i < copies; i++ {
+			if f.delay <= 0 {
+				next(to, m)
+				continue
+			}
+			d := time.Duration(rand.Int63n(int64(f.delay)))
+			if f.reorder {
+				time.AfterFunc(d, func() { next(to, m) })
+			} else {
+				time.Sleep(d)
+				next(to, m)
+			}
+		}
+	}
+}
+
+// Draw a duration with mean d from the named distribution
+func draw(d time.Duration, dist string) time.Duration {
+	switch dist {
+	case "uniform":
+		return time.Duration(rand.Int63n(2*int64(d) + 1))
+	case "exp":
+		return time.Duration(rand.ExpFloat64() * float64(d))
+	}
+	return d
+}
+
+// Print a summary of acquisition wait times, throughput and message counts
+func report(waits []time.Duration, elapsed time.Duration, msgs int64) {
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	at := func(q float64) time.Duration {
+		return waits[int(q*float64(len(waits)-1))]
+	}
+	log.Printf("Wait: min %v, median %v, p99 %v, max %v",
+		waits[0], at(0.5), at(0.99), waits[len(waits)-1])
+	log.Printf("Throughput: %d acquisitions in %v (%.1f/s)",
+		len(waits), elapsed.Round(time.Millisecond), float64(len(waits))/elapsed.Seconds())
+	log.Printf("Messages: %d sent (%.1f per acquisition)",
+		msgs, float64(msgs)/float64(len(waits)))
+}
+
+// Run the Lamport distributed lock demo for n communicating goroutines,
+// returning the first failure seen by any of them
+func demo(n int, prof profile, f faults) error {
+	// count messages sent by all processes
+	var msgs int64
+	count := func(next lamport.Handler) lamport.Handler {
+		return func(to int, m lamport.Message) {
+			atomic.AddInt64(&msgs, 1)
+			next(to, m)
+		}
+	}
+
+	// start a distributed lock for each goroutine, for each lock
+	locks := make([][]*lamport.LamportLockState, prof.locks)
+	for l := range locks {
+		locks[l] = lamport.NewLocalCluster(n, lamport.WithOutbound(count, f.inject))
 	}
 
+	// collect per-acquisition wait times
+	var wlock sync.Mutex
+	waits := make([]time.Duration, 0, n*prof.iters)
+	start := time.Now()
+
 	// initialize the waitgroup
 	var group sync.WaitGroup
 	group.Add(n)
 
-	// initialize the shared test var
-	var tvar int32
+	// initialize the shared test vars (one per lock)
+	tvars := make([]int32, prof.locks)
+
+	// record the first failure, for the workers to stop on
+	var flock sync.Mutex
+	var failed error
+	fail := func(err error) {
+		flock.Lock()
+		if failed == nil {
+			failed = err
+		}
+		flock.Unlock()
+	}
+	stopped := func() bool {
+		flock.Lock()
+		defer flock.Unlock()
+		return failed != nil
+	}
 
 	// spawn goroutine "workers"
-	for p, _ := range chs {
-		go func(myProc int, ptvar *int32) {
-			// initialize the distributed lock
-			lock := lamport.Start(myProc, chs)
+	for p := 0; p < n; p++ {
+		go func(myProc int) {
+			// sync
+			defer group.Done()
 
-			// acquire
-			lock.Acquire()
-			log.Println(myProc, "Acquired lock")
+			for i := 0; i < prof.iters && !stopped(); i++ {
+				// pick a lock
+				l := rand.Intn(prof.locks)
+				lock := locks[l][myProc]
 
-			// lock is acquired - set the test var to my proc id
-			atomic.StoreInt32(ptvar, int32(myProc))
+				// acquire
+				t := time.Now()
+				guard, err := lock.Acquire()
+				if err != nil {
+					fail(fmt.Errorf("acquire failed: %v", err))
+					return
+				}
+				wlock.Lock()
+				waits = append(waits, time.Since(t))
+				wlock.Unlock()
+				log.Println(myProc, "Acquired lock", l, "token", guard.Token())
 
-			// sleep for a bit
-			time.Sleep(100 * time.Millisecond)
+				// lock is acquired - set the test var to my proc id
+				atomic.StoreInt32(&tvars[l], int32(myProc))
 
-			// sample the test var
-			tval := atomic.LoadInt32(ptvar)
+				// sleep for a bit
+				time.Sleep(draw(prof.hold, prof.dist))
 
-			// release
-			lock.Release()
-			log.Println(myProc, "Released lock")
+				// sample the test var
+				tval := atomic.LoadInt32(&tvars[l])
 
-			// check the sampled test var
-			if tval != int32(myProc) {
-				log.Fatal("Error: test var =", tval, "!= myProc")
-			} else {
-				log.Println(" OK: mutating test var is still", tval)
-			}
+				// release
+				guard.Release()
+				log.Println(myProc, "Released lock", l)
 
-			// sync
-			group.Done()
-		}(p, &tvar)
+				// check the sampled test var
+				if tval != int32(myProc) {
+					fail(fmt.Errorf("test var = %d != myProc %d", tval, myProc))
+					return
+				} else {
+					log.Println(" OK: mutating test var is still", tval)
+				}
+
+				// think before the next acquisition
+				time.Sleep(draw(prof.think, prof.dist))
+			}
+		}(p)
 	}
 
 	// wait on the team
 	group.Wait()
+	if failed == nil {
+		report(waits, time.Since(start), atomic.LoadInt64(&msgs))
+	}
+
+	// leave the groups
+	for _, cluster := range locks {
+		for _, lock := range cluster {
+			lock.Stop()
+		}
+	}
+	return failed
 }
 
 func main() {
 	// get number of processes (goroutines in the demo)
 	var n = flag.Int("n", 2, "number of processes")
+
+	// get the contention profile
+	var prof profile
+	flag.IntVar(&prof.iters, "iters", 1, "acquisitions per worker")
+	flag.DurationVar(&prof.hold, "hold", 100*time.Millisecond, "mean critical section duration")
+	flag.StringVar(&prof.dist, "dist", "fixed", "distribution of durations: fixed, uniform or exp")
+	flag.DurationVar(&prof.think, "think", 0, "mean time between acquisitions")
+	flag.IntVar(&prof.locks, "locks", 1, "number of independent locks")
+
+	// get the faults to inject
+	var f faults
+	var links = flag.String("faults", "", "links to inject faults on, e.g. 0>1,2>0 (default all)")
+	flag.DurationVar(&f.delay, "delay", 0, "maximum (random) message delay")
+	flag.BoolVar(&f.reorder, "reorder", false, "let delayed messages overtake each other")
+	flag.Float64Var(&f.drop, "drop", 0, "probability of dropping a message")
+	flag.Float64Var(&f.dup, "dup", 0, "probability of duplicating a message")
 	flag.Parse()
 
-	// check n for sensible values
+	// check parameters for sensible values
 	if *n < 2 {
 		log.Fatal("Error: nonsense number of processes ", *n)
 	}
+	if prof.iters < 1 || prof.locks < 1 {
+		log.Fatal("Error: nonsense number of acquisitions or locks")
+	}
+	if prof.dist != "fixed" && prof.dist != "uniform" && prof.dist != "exp" {
+		log.Fatal("Error: unknown distribution ", prof.dist)
+	}
+
+	var err error
+	if f.links, err = parseLinks(*links); err != nil {
+		log.Fatal("Error: ", err)
+	}
 
 	// run the demo
-	demo(*n)
+	if err := demo(*n, prof, f); err != nil {
+		log.Fatal("Error: ", err)
+	}
 }
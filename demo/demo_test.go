@@ -0,0 +1,22 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+// Delaying messages in order slows the lock down without breaking it
+func TestDemoDelay(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	prof := profile{iters: 50, hold: 200 * time.Microsecond, dist: "uniform", locks: 1}
+	for _, n := range []int{2, 3} {
+		if err := demo(n, prof, faults{delay: 3 * time.Millisecond}); err != nil {
+			t.Fatalf("%d processes: %v", n, err)
+		}
+	}
+}
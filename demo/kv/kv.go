@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/swfrench/lamport-go"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Command for the replicated key-value store
+type put struct {
+	key   string
+	value string
+}
+
+// Key-value store replicated by applying put commands in log order
+type store struct {
+	data map[string]string
+}
+
+func (s *store) apply(cmd put) {
+	s.data[cmd.key] = cmd.value
+}
+
+// Render the store contents in key order
+func (s *store) String() string {
+	keys := make([]string, 0, len(s.data))
+	for k := range s.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s ", k, s.data[k])
+	}
+	return b.String()
+}
+
+// Run the replicated key-value store demo for n communicating goroutines
+func demo(n int) {
+	// initialize the locks, stores and replicas
+	locks := lamport.NewLocalCluster(n)
+	stores := make([]*store, n)
+	replicas := make([]*lamport.Replica[put], n)
+	for p := range locks {
+		stores[p] = &store{data: make(map[string]string)}
+		replicas[p] = lamport.NewReplica[put](locks[p], stores[p].apply)
+	}
+
+	// each replica writes its own key and a contended shared key
+	var group sync.WaitGroup
+	group.Add(n)
+	for p := range locks {
+		go func(myProc int) {
+			r := replicas[myProc]
+			if err := r.Submit(put{fmt.Sprint("key", myProc), "set"}); err != nil {
+				log.Fatal("Error: submit failed: ", err)
+			}
+			if err := r.Submit(put{"last", fmt.Sprint(myProc)}); err != nil {
+				log.Fatal("Error: submit failed: ", err)
+			}
+			group.Done()
+		}(p)
+	}
+	group.Wait()
+
+	// catch up and check that all replicas agree
+	for p, r := range replicas {
+		if err := r.Sync(); err != nil {
+			log.Fatal("Error: sync failed: ", err)
+		}
+		log.Println(p, stores[p])
+		if stores[p].String() != stores[0].String() {
+			log.Fatal("Error: replica ", p, " diverged from replica 0")
+		}
+	}
+	log.Println(" OK: all replicas agree")
+
+	// leave the group
+	for _, l := range locks {
+		l.Stop()
+	}
+}
+
+func main() {
+	// get number of processes (goroutines in the demo)
+	var n = flag.Int("n", 3, "number of replicas")
+	flag.Parse()
+
+	// check n for sensible values
+	if *n < 2 {
+		log.Fatal("Error: nonsense number of replicas ", *n)
+	}
+
+	// run the demo
+	demo(*n)
+}
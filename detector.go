@@ -0,0 +1,100 @@
+package lamport
+
+import (
+	"math"
+	"time"
+)
+
+// Source of liveness information about peers, marking suspected peers
+// unreachable (see Health) in place of the partition timeout
+// Deployments can plug in their own (e.g. backed by an orchestrator's view
+// of its pods). Each process has its own detector (see WithFailureDetector),
+// whose calls are made sequentially, under the process's state mutex, so
+// must not block.
+type FailureDetector interface {
+	// Record that a message from peer p arrived at the given time
+	Heard(p int, at time.Time)
+	// Report whether peer p is suspected to have failed
+	Suspected(p int, now time.Time) bool
+}
+
+// Number of inter-arrival times each peer's history holds (see
+// PhiAccrualDetector)
+const PhiWindow = 100
+
+// Phi accrual failure detector (Hayashibara et al.), suspecting a peer once
+// the silence since its last message becomes unlikely given the history of
+// its inter-arrival times
+// Peers must send steadily for their history to be meaningful, so use it
+// with keepalives (see WithKeepalive). A detector holds a single process's
+// view of its peers, and is not threadsafe.
+type PhiAccrualDetector struct {
+	Threshold float64       // Suspicion level (phi) at which to suspect a peer
+	MinStdDev time.Duration // Floor on the deviation, absorbing jitter in regular arrivals
+	peers     map[int]*arrivals
+}
+
+// Inter-arrival history of a peer
+type arrivals struct {
+	last time.Time
+	ints []float64 // in seconds, as a ring of up to PhiWindow
+	next int
+}
+
+// Create a phi accrual detector suspecting peers at the given phi (8 is a
+// common choice: roughly a one in 10^8 chance of a false suspicion)
+func NewPhiAccrualDetector(threshold float64) *PhiAccrualDetector {
+	return &PhiAccrualDetector{
+		Threshold: threshold,
+		MinStdDev: 10 * SleepTime,
+		peers:     make(map[int]*arrivals)}
+}
+
+// Add the interval since p's previous message to its history
+func (d *PhiAccrualDetector) Heard(p int, at time.Time) {
+	a, ok := d.peers[p]
+	if !ok {
+		d.peers[p] = &arrivals{last: at}
+		return
+	}
+	if i := at.Sub(a.last).Seconds(); i > 0 {
+		if len(a.ints) < PhiWindow {
+			a.ints = append(a.ints, i)
+		} else {
+			a.ints[a.next] = i
+			a.next = (a.next + 1) % PhiWindow
+		}
+		a.last = at
+	}
+}
+
+// Compare p's current suspicion level to the threshold (peers never heard
+// from twice are not suspected)
+func (d *PhiAccrualDetector) Suspected(p int, now time.Time) bool {
+	a, ok := d.peers[p]
+	if !ok || len(a.ints) == 0 {
+		return false
+	}
+	return phi(now.Sub(a.last).Seconds(), a.ints, d.MinStdDev.Seconds()) >= d.Threshold
+}
+
+// Suspicion level after t seconds of silence, approximating the normal
+// distribution of the given intervals with a logistic function
+func phi(t float64, ints []float64, minStd float64) float64 {
+	var mean, sq float64
+	for _, i := range ints {
+		mean += i
+		sq += i * i
+	}
+	mean /= float64(len(ints))
+	std := math.Sqrt(math.Max(sq/float64(len(ints))-mean*mean, 0))
+	if std < minStd {
+		std = minStd
+	}
+	y := (t - mean) / std
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if t > mean {
+		return -math.Log10(e / (1 + e))
+	}
+	return -math.Log10(1 - 1/(1+e))
+}
@@ -0,0 +1,60 @@
+package lamport
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Check whether the local process reports peer p unreachable
+func (state *LamportLockState) reportsSilent(p int) bool {
+	for _, q := range state.Health().Silent {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Each process of a cluster judges its peers with its own detector, so a
+// link failing only towards one process is reported by that process alone
+func TestFailureDetectorPerProcess(t *testing.T) {
+	var lock sync.Mutex
+	var made []int
+	var cut int32
+	drop := func(next Handler) Handler {
+		return func(to int, m Message) {
+			if atomic.LoadInt32(&cut) == 1 && m.Proc == 2 && to == 0 {
+				return
+			}
+			next(to, m)
+		}
+	}
+	ls := NewLocalCluster(3,
+		WithFailureDetector(func(p int) FailureDetector {
+			lock.Lock()
+			made = append(made, p)
+			lock.Unlock()
+			return NewPhiAccrualDetector(8)
+		}),
+		WithKeepalive(time.Millisecond),
+		WithOutbound(drop))
+	defer stopAll(ls)
+
+	sort.Ints(made)
+	if len(made) != 3 || made[0] != 0 || made[1] != 1 || made[2] != 2 {
+		t.Fatalf("detectors made for processes %v, want one each", made)
+	}
+
+	// let the detectors learn the keepalive rate, then cut 2 off from 0
+	time.Sleep(200 * time.Millisecond)
+	atomic.StoreInt32(&cut, 1)
+	waitFor(t, func() bool { return ls[0].reportsSilent(2) })
+	if ls[1].reportsSilent(2) {
+		t.Error("process 1 reports 2 unreachable, though only its link to 0 failed")
+	}
+	g := mustAcquire(t, ls[1])
+	g.Release()
+}
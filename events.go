@@ -0,0 +1,106 @@
+package lamport
+
+import "sort"
+
+// Protocol event delivered to subscribers (see Subscribe): one of
+// MessageEvent, QueueEvent, ClockEvent or GrantEvent
+type Event interface {
+	event()
+}
+
+// A message was received from a peer
+type MessageEvent struct {
+	Message Message
+}
+
+// The request queue changed
+type QueueEvent struct {
+	Queue []Message // Queued requests, in order
+}
+
+// The local logical clock advanced (possibly by several ticks)
+type ClockEvent struct {
+	Time int
+}
+
+// The local process was granted the lock
+type GrantEvent struct {
+	Time  int // Logical time of the grant
+	Token int // Fencing token of the grant
+}
+
+func (MessageEvent) event() {}
+func (QueueEvent) event()   {}
+func (ClockEvent) event()   {}
+func (GrantEvent) event()   {}
+
+// Subscribe to protocol events, buffering up to n of them
+// Events are dropped rather than stalling the lock if the buffer is full.
+// The channel is closed by the returned cancel function, or once the lock
+// is stopped.
+func (state *LamportLockState) Subscribe(n int) (<-chan Event, func()) {
+	c := make(chan Event, n)
+
+	// lock state struct (mutating subs)
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.stop {
+		close(c)
+		return c, func() {}
+	}
+	state.subs = append(state.subs, c)
+	state.ptim, state.pver = state.time, state.qver
+
+	return c, func() {
+		state.lock.Lock()
+		defer state.lock.Unlock()
+		for i, s := range state.subs {
+			if s == c {
+				state.subs = append(state.subs[:i], state.subs[i+1:]...)
+				close(c)
+				return
+			}
+		}
+	}
+}
+
+// Deliver an event to every subscriber with room for it
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) emit(e Event) {
+	for _, c := range state.subs {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+// Emit clock and queue events for any changes since the last call, first
+// checking invariants (see WithInvariants) and waking a waiting request that
+// can now proceed (see notifyWaiter)
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) publish() {
+	state.checkInvariants()
+	state.notifyWaiter()
+	if len(state.subs) > 0 {
+		if state.time != state.ptim {
+			state.emit(ClockEvent{Time: state.time})
+		}
+		if state.qver != state.pver {
+			q := append([]Message(nil), *state.reqs...)
+			sort.Slice(q, func(i, j int) bool { return q[i].before(q[j]) })
+			state.emit(QueueEvent{Queue: q})
+		}
+	}
+	state.ptim, state.pver = state.time, state.qver
+}
+
+// Close all subscriptions, once the lock has stopped (threadsafe)
+func (state *LamportLockState) closeSubs() {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	for _, c := range state.subs {
+		close(c)
+	}
+	state.subs = nil
+}
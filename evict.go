@@ -0,0 +1,103 @@
+package lamport
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Returned by ForceRelease if no admin secret is configured
+var ErrNoAdmin = errors.New("lamport: admin operations not enabled")
+
+// Returned by Acquire when our pending request is evicted (see ForceRelease)
+var ErrEvicted = errors.New("lamport: request evicted")
+
+// Audit record of an administrative eviction, delivered on every process
+type Eviction struct {
+	By     int // Process that issued the eviction
+	Target int // Process whose requests were purged
+	Time   int // Logical time of the eviction
+}
+
+// Authenticate an eviction message with the shared secret
+func evictMAC(secret []byte, m Message) []byte {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "evict:%d:%d:%d", m.Proc, m.Time, m.Dest)
+	return mac.Sum(nil)
+}
+
+// Purge the target's requests on an authenticated eviction
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) evict(m Message) {
+	if len(state.opts.secret) == 0 || !hmac.Equal(m.Auth, evictMAC(state.opts.secret, m)) {
+		log.Printf("lamport: process %d rejected unauthenticated eviction of %d from %d",
+			state.proc, m.Dest, m.Proc)
+		return
+	}
+
+	// if we are the target, the service loop notices the loss of a grant
+	// (see Guard.Done); a pending request is failed instead, its acks still
+	// due from peers discarded as they arrive (see ackReceived)
+	if m.Dest == state.proc && state.held == nil {
+		if _, ok := state.ownRequest(); ok {
+			state.abandonAcks(false)
+			state.evct = true
+		}
+	}
+	state.removeRequests(m.Dest)
+
+	e := Eviction{By: m.Proc, Target: m.Dest, Time: m.Time}
+	log.Printf("lamport: process %d evicted by %d (seen by %d)", e.Target, e.By, state.proc)
+	state.audit(AuditRecord{Kind: AuditEvict, Proc: e.Target, By: e.By, Time: e.Time})
+	if fn := state.opts.onEvict; fn != nil {
+		go fn(e)
+	}
+}
+
+// Forcibly evict proc (e.g. a stuck holder, see Holder) from the lock
+// cluster-wide, purging its queued requests on every process
+// Requires the shared admin secret (see WithAdmin) on all processes. Any
+// guard held by proc is lost (see Guard.Done); proc itself stays in the
+// group and may request the lock again, while a pending Acquire of proc
+// fails with ErrEvicted.
+func (state *LamportLockState) ForceRelease(proc int) error {
+	// lock state struct (mutating time and reqs)
+	state.lock.Lock()
+
+	if len(state.opts.secret) == 0 {
+		state.lock.Unlock()
+		return ErrNoAdmin
+	}
+	if state.stop {
+		state.lock.Unlock()
+		return ErrStopped
+	}
+
+	// advance logical time, initialize message, evict locally
+	state.time += 1
+	m := Message{
+		Type: MessageEvict,
+		Time: state.time,
+		Proc: state.proc,
+		Dest: proc}
+	m.Auth = evictMAC(state.opts.secret, m)
+	state.evict(m)
+	state.publish()
+	state.postAll(m)
+
+	// release
+	state.lock.Unlock()
+
+	// send eviction message
+	state.flush()
+	return nil
+}
+
+// Check whether our pending request was evicted (threadsafe)
+func (state *LamportLockState) evicted() bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.evct
+}
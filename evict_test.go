@@ -0,0 +1,55 @@
+package lamport
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Evicting a waiting process fails its Acquire, and leaves the cluster able
+// to grant the lock in token order
+func TestForceReleaseWaiter(t *testing.T) {
+	ls := NewLocalCluster(3, WithAdmin([]byte("secret"), nil))
+	defer stopAll(ls)
+
+	g, err := ls[0].Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := make(chan error, 1)
+	go func() {
+		_, err := ls[1].Acquire()
+		res <- err
+	}()
+	waitFor(t, func() bool { return ls[0].queueLen() == 2 })
+
+	if err := ls[2].ForceRelease(1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-res:
+		if !errors.Is(err, ErrEvicted) {
+			t.Fatalf("evicted Acquire returned %v, want ErrEvicted", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("evicted Acquire did not return")
+	}
+	if err := g.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	last := g.Token()
+	for i := 0; i < 2; i++ {
+		for p := range ls {
+			g, err := ls[p].Acquire()
+			if err != nil {
+				t.Fatalf("process %d: %v", p, err)
+			}
+			if g.Token() <= last {
+				t.Errorf("process %d granted token %d after %d", p, g.Token(), last)
+			}
+			last = g.Token()
+			g.Release()
+		}
+	}
+}
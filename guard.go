@@ -0,0 +1,136 @@
+package lamport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Returned when a Guard is used after it has been released
+var ErrReleased = errors.New("lamport: guard already released")
+
+// Handle on a held distributed lock, returned by Acquire
+// A Guard is single-use: once released (or transferred) it cannot be used
+// again.
+type Guard struct {
+	state *LamportLockState
+	token int
+	meta  map[string]string
+	at    time.Time     // time of grant
+	stack []byte        // stack of acquiring goroutine (see WithLongHold)
+	warn  bool          // long hold already reported
+	done  chan struct{} // closed once the grant ends
+	lock  sync.Mutex
+	used  bool
+	from  context.Context // context of the acquiring call, if any (see Context)
+	ctx   context.Context // created on first use (see Context)
+}
+
+// End the current grant, notifying its guard (see Guard.Done) and
+// recording it in the audit trail as the given kind
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) dropGuard(kind string) {
+	if state.held != nil {
+		held := state.opts.clock.Now().Sub(state.held.at)
+		state.stat.released(held)
+		state.audit(AuditRecord{
+			Kind:  kind,
+			Proc:  state.proc,
+			By:    state.proc,
+			Token: state.held.token,
+			Held:  held,
+			Meta:  state.held.meta})
+		state.traceLocal("grant of token %d ended (%s)", state.held.token, kind)
+		close(state.held.done)
+		state.held = nil
+	}
+}
+
+// Mark the guard as used, returning ErrReleased if it already was
+func (g *Guard) use() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.used {
+		return ErrReleased
+	}
+	g.used = true
+	return nil
+}
+
+// Fencing token for this grant
+// Tokens are distinct per holder and increase in grant order, so downstream
+// resources can reject writes from holders that have since been superseded.
+func (g *Guard) Token() int {
+	return g.token
+}
+
+// Metadata supplied with the request for this grant, if any
+// (see AcquireWithMetadata)
+func (g *Guard) Metadata() map[string]string {
+	return g.meta
+}
+
+// Channel that is closed when this guard no longer holds the lock
+// This happens on Release or TransferTo, but also if the process finds it
+// has lost the lock (e.g. when stopped), so critical sections can select on
+// it to abort promptly.
+func (g *Guard) Done() <-chan struct{} {
+	return g.done
+}
+
+// Context for work done under this guard, cancelled once the lock is no
+// longer held (as for Done), or when the context passed to AcquireContext
+// is done
+// Pass it to downstream operations so that they are interrupted if the
+// lock is lost mid-way, e.g. on eviction or lease expiry; context.Cause then
+// reports ErrNotHeld.
+func (g *Guard) Context() context.Context {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.ctx == nil {
+		from := g.from
+		if from == nil {
+			from = context.Background()
+		}
+		ctx, cancel := context.WithCancelCause(from)
+		go func() {
+			select {
+			case <-g.done:
+				cancel(ErrNotHeld)
+			case <-ctx.Done():
+			}
+		}()
+		g.ctx = ctx
+	}
+	return g.ctx
+}
+
+// Release the distributed lock
+// A no-op if Stop has since released the lock, having given up waiting for
+// this release (see StopContext). Returns ErrNotHeld if the lock was
+// otherwise lost (e.g. evicted, see ForceRelease) before the release.
+func (g *Guard) Release() error {
+	if err := g.use(); err != nil {
+		return err
+	}
+	return g.state.sendReleaseMsg(g)
+}
+
+// Transfer the held lock directly to proc, bypassing queue order
+// The target must already have a pending request (i.e. be waiting in
+// Acquire), which it agrees to have granted out of order. On success, the
+// guard is spent, as though it had been released.
+func (g *Guard) TransferTo(proc int) error {
+	if err := g.use(); err != nil {
+		return err
+	}
+	if err := g.state.transferTo(proc, g.token); err != nil {
+		// nothing was transferred: the guard still holds the lock
+		g.lock.Lock()
+		g.used = false
+		g.lock.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package lamport
+
+import "net/http"
+
+// Maximum time since the last service loop iteration for a process to be
+// considered alive (the loop can stall, e.g., on a full peer channel)
+const LivenessTimeout = 100 * SleepTime
+
+// Check whether the service loop is running and making progress
+func (state *LamportLockState) Alive() bool {
+	state.lock.Lock()
+	last := state.last
+	state.lock.Unlock()
+	return !last.IsZero() && state.opts.clock.Now().Sub(last) < LivenessTimeout
+}
+
+// Check whether the process is alive and can reach a quorum of its peers
+// A peer is considered reachable if sends to its channel will not block.
+func (state *LamportLockState) Ready() bool {
+	if !state.Alive() {
+		return false
+	}
+	reachable := 1 // ourselves
+	for p, chn := range state.chns {
+		if p != state.proc && len(chn) < cap(chn) {
+			reachable += 1
+		}
+	}
+	return reachable > len(state.chns)/2
+}
+
+// Serve a health check: 200 if check() passes, 503 otherwise
+func healthHandler(check func() bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check() {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("ok\n"))
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("unavailable\n"))
+		}
+	})
+}
+
+// HTTP handler reporting liveness (see Alive)
+func (state *LamportLockState) LivenessHandler() http.Handler {
+	return healthHandler(state.Alive)
+}
+
+// HTTP handler reporting readiness (see Ready)
+func (state *LamportLockState) ReadinessHandler() http.Handler {
+	return healthHandler(state.Ready)
+}
@@ -0,0 +1,90 @@
+package lamport
+
+import "time"
+
+// Number of heartbeat intervals without a heartbeat after which a holder
+// is considered stuck
+const HeartbeatMisses = 3
+
+// View of the process at the head of the local queue, i.e. the (oldest)
+// holder of the lock as far as the local process can tell
+type HolderInfo struct {
+	Proc  int           // Process at the head of the queue
+	Held  time.Duration // Time since it reached the head of the queue
+	Quiet time.Duration // Time since its last heartbeat (or reaching the head)
+	Stuck bool          // It has missed HeartbeatMisses heartbeats
+}
+
+// Broadcast a holder heartbeat if we hold the lock and one is due
+// (threadsafe)
+func (state *LamportLockState) sendHeartbeat() {
+	// lock state struct (mutating time)
+	state.lock.Lock()
+
+	// check whether a heartbeat is due
+	h := state.opts.heartbeat
+	now := state.opts.clock.Now()
+	if h <= 0 || state.held == nil || now.Sub(state.hbat) < h {
+		state.lock.Unlock()
+		return
+	}
+	state.hbat = now
+
+	// advance logical time, initialize message
+	state.time += 1
+	m := Message{
+		Type: MessageHeartbeat,
+		Time: state.time,
+		Proc: state.proc,
+		Tokn: state.held.token}
+	state.postLossy(m)
+
+	// release
+	state.lock.Unlock()
+
+	// send heartbeat message (a missed heartbeat is harmless)
+	state.flush()
+}
+
+// Note when the head of the queue changes
+// Not threadsafe on its own: called only from serviceMessages (within locked
+// region)
+func (state *LamportLockState) updateHead() {
+	head := -1
+	if state.reqs.Len() > 0 {
+		head = (*state.reqs)[0].Proc
+	}
+	if head != state.head {
+		state.head = head
+		state.hdat = state.opts.clock.Now()
+	}
+}
+
+// Report the process at the head of the local queue, if any
+// Stuck is only reported if heartbeats are enabled (see WithHeartbeat), and
+// then only when the head has been there for long enough to have acquired
+// the lock and sent heartbeats. When the lock is shared (see WithHolders
+// and AcquireSession), only the oldest holder is reported.
+func (state *LamportLockState) Holder() (HolderInfo, bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.head < 0 {
+		return HolderInfo{}, false
+	}
+	now := state.opts.clock.Now()
+	last := state.hdat
+	if state.head == state.proc {
+		// we know whether we are stuck
+		last = now
+	} else if state.beat[state.head].After(last) {
+		last = state.beat[state.head]
+	}
+	info := HolderInfo{
+		Proc:  state.head,
+		Held:  now.Sub(state.hdat),
+		Quiet: now.Sub(last)}
+	if h := state.opts.heartbeat; h > 0 {
+		info.Stuck = info.Quiet > HeartbeatMisses*h
+	}
+	return info, true
+}
@@ -0,0 +1,41 @@
+package lamport
+
+import (
+	"testing"
+	"time"
+)
+
+// Up to k processes hold the lock at once, each with its own token, while
+// the next waits for one of them to release
+func TestHolders(t *testing.T) {
+	ls := NewLocalCluster(3, WithHolders(2))
+	defer stopAll(ls)
+
+	g0, g1 := mustAcquire(t, ls[0]), mustAcquire(t, ls[1])
+	got := make(chan *Guard, 1)
+	go func() {
+		g, _ := ls[2].Acquire()
+		got <- g
+	}()
+	select {
+	case <-got:
+		t.Fatal("third process granted lock alongside two holders")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	g0.Release()
+	var g2 *Guard
+	select {
+	case g2 = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("third process not granted lock once a holder released")
+	}
+	if !(g0.Token() < g1.Token() && g1.Token() < g2.Token()) {
+		t.Errorf("tokens %d, %d, %d not increasing in grant order", g0.Token(), g1.Token(), g2.Token())
+	}
+	g1.Release()
+	g2.Release()
+
+	// under contention, never more than k at once
+	checkHolders(t, ls, 2, 50)
+}
@@ -0,0 +1,83 @@
+package lamport
+
+import (
+	"context"
+	"errors"
+)
+
+// Returned by AcquireIfIdle when other requests are queued
+var ErrBusy = errors.New("lamport: lock is contended")
+
+// Check, once every live peer has acknowledged our pending request, whether
+// ours is the only request queued: returns a new Guard if so, and whether
+// the lock is busy (threadsafe)
+func (state *LamportLockState) grantIfIdle() (*Guard, bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if !state.allAcked() {
+		return nil, false
+	}
+	if state.reqs.Len() > 1 || !state.holdsLock() {
+		return nil, true
+	}
+	return state.newGuard(), false
+}
+
+// Acquire the distributed lock only if no other process is requesting it,
+// e.g. for background work that should defer to any foreground work
+// The request waits for an ack from every live peer: its FIFO channel
+// delivers any earlier request from that peer first, so if none is queued by
+// then, the lock is uncontended. Otherwise the request is retracted and
+// ErrBusy returned. Also returns ErrStopped, ErrStale, ErrEvicted and
+// (after the ack timeout) a *ProgressError, as Acquire, but never retries.
+func (state *LamportLockState) AcquireIfIdle() (*Guard, error) {
+	select {
+	case <-state.join:
+	case <-state.quit:
+		return nil, ErrStopped
+	}
+	if err := state.awaitRateLimit(context.Background()); err != nil {
+		return nil, err
+	}
+
+	// initiate new request
+	t, err := state.sendRequestMsg("", nil)
+	if err != nil {
+		return nil, err
+	}
+	sent := state.opts.clock.Now()
+	state.lock.Lock()
+	state.idlr = true
+	state.notifyWaiter()
+	state.lock.Unlock()
+
+	// now wait for every ack ...
+	for {
+		if state.nacked() {
+			state.retractRequest()
+			return nil, ErrStale
+		}
+		if state.evicted() {
+			// withdraw it from peers that queued it anyway (see request)
+			state.retractRequest()
+			return nil, ErrEvicted
+		}
+		if g, busy := state.grantIfIdle(); g != nil {
+			state.stat.acquired(g.at.Sub(sent))
+			return g, nil
+		} else if busy {
+			state.retractRequest()
+			return nil, ErrBusy
+		}
+		if state.stopped() {
+			return nil, ErrStopped
+		}
+		if timeout := state.current().ackTimeout; timeout > 0 && state.opts.clock.Now().Sub(sent) > timeout {
+			if peers := state.unresponsivePeers(t); len(peers) > 0 {
+				state.retractRequest()
+				return nil, &ProgressError{Peers: peers, Trace: state.Trace()}
+			}
+		}
+		state.awaitProgress(context.Background(), sent)
+	}
+}
@@ -0,0 +1,28 @@
+package lamport
+
+// Queue a message from the inbound chain for service (threadsafe)
+// Messages normally arrive from serve itself, which services them once its
+// batch is drained; the kick covers interceptors passing messages on later,
+// from other goroutines.
+func (state *LamportLockState) inbox(m Message) {
+	state.ilck.Lock()
+	state.inbx = append(state.inbx, m)
+	state.ilck.Unlock()
+	select {
+	case state.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Take the queued inbound messages, handing back the previous batch's
+// buffer for reuse (threadsafe)
+func (state *LamportLockState) takeInbox(spare []Message) []Message {
+	for i := range spare {
+		spare[i] = Message{}
+	}
+	state.ilck.Lock()
+	ms := state.inbx
+	state.inbx = spare[:0]
+	state.ilck.Unlock()
+	return ms
+}
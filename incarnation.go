@@ -0,0 +1,78 @@
+package lamport
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+)
+
+// Latest incarnation issued in this program (see newIncarnation)
+var lastIncarnation int64
+
+// Key under which process p persists its incarnation (see WithClockStore)
+func incarnationKey(p int) string {
+	return fmt.Sprintf("incarnation-%d", p)
+}
+
+// Pick an incarnation later than any previous one of this process: its
+// start time in nanoseconds, unless that is no later than the last one
+// persisted (see WithClockStore) or issued in this program, e.g. because the
+// wall clock stepped backwards or a fake clock (see WithClock) is in use
+// Without a store, an incarnation from before a crash is only outrun by the
+// clock, so a clock stepped back across the restart gets the process's
+// messages dropped as ghosts until it catches up.
+// Not threadsafe on its own: called only from initState
+func (state *LamportLockState) newIncarnation() int64 {
+	n := state.opts.clock.Now().UnixNano()
+	if s := state.opts.store; s != nil {
+		data, err := s.Load(incarnationKey(state.proc))
+		var last int64
+		if err == nil && data != nil {
+			last, err = strconv.ParseInt(string(data), 10, 64)
+		}
+		if err != nil {
+			log.Printf("lamport: process %d failed to restore incarnation: %v", state.proc, err)
+		} else if n <= last {
+			n = last + 1
+		}
+	}
+	for {
+		last := atomic.LoadInt64(&lastIncarnation)
+		if n <= last {
+			n = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastIncarnation, last, n) {
+			break
+		}
+	}
+	if s := state.opts.store; s != nil {
+		if err := s.Save(incarnationKey(state.proc), []byte(strconv.FormatInt(n, 10))); err != nil {
+			log.Printf("lamport: process %d failed to persist incarnation: %v", state.proc, err)
+		}
+	}
+	return n
+}
+
+// Interceptor stamping outgoing messages with our incarnation, ahead of
+// any outbound interceptors
+func (state *LamportLockState) stampIncarnation(next Handler) Handler {
+	return func(to int, m Message) {
+		m.Incn = state.incn
+		next(to, m)
+	}
+}
+
+// Check whether a message comes from its origin's latest incarnation,
+// adopting it if newer; messages from a previous incarnation (e.g. delayed
+// in transit across a restart) are ghosts, to be dropped unprocessed and
+// unacknowledged
+// Not threadsafe on its own: called only from serviceMessages (within locked
+// region)
+func (state *LamportLockState) currentIncarnation(m Message) bool {
+	if m.Incn < state.pinc[m.Proc] {
+		return false
+	}
+	state.pinc[m.Proc] = m.Incn
+	return true
+}
@@ -0,0 +1,156 @@
+package lamport
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Make channels for an n-process cluster (see NewLocalCluster)
+func localChannels(n int) []chan Message {
+	chns := make([]chan Message, n)
+	for p := range chns {
+		chns[p] = make(chan Message, LocalClusterBuffer)
+	}
+	return chns
+}
+
+// Interceptor withholding messages to one process while held, for release
+// later (e.g. after their sender has restarted)
+type withholder struct {
+	lock sync.Mutex
+	to   int
+	hold bool
+	msgs []Message
+	next Handler
+}
+
+func (w *withholder) intercept(next Handler) Handler {
+	return func(to int, m Message) {
+		w.lock.Lock()
+		if w.hold && to == w.to {
+			w.msgs = append(w.msgs, m)
+			w.next = next
+			w.lock.Unlock()
+			return
+		}
+		w.lock.Unlock()
+		next(to, m)
+	}
+}
+
+// Deliver the withheld messages, in order
+func (w *withholder) release() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, m := range w.msgs {
+		w.next(w.to, m)
+	}
+	w.msgs, w.hold = nil, false
+}
+
+// Messages from a previous incarnation delayed past a Rejoin are dropped:
+// its request is not queued, nor its Depart taken to mean the process left
+// The clock is fake and never moves, so incarnations cannot come from it.
+func TestGhostsDroppedAfterRejoin(t *testing.T) {
+	clk := newFakeClock()
+	chns := localChannels(3)
+	w := &withholder{to: 0, hold: true}
+	l0, l2 := Start(0, chns, WithClock(clk)), Start(2, chns, WithClock(clk))
+	defer l0.Stop()
+	defer l2.Stop()
+
+	// the old incarnation requests, then stops, with both withheld from 0
+	old := Start(1, chns, WithClock(clk), WithOutbound(w.intercept))
+	res := make(chan error, 1)
+	go func() {
+		_, err := old.Acquire()
+		res <- err
+	}()
+	waitFor(t, func() bool { return l2.queueLen() == 1 })
+	old.Stop()
+	<-res
+
+	// restart, then let the ghosts through
+	l1 := Rejoin(1, chns, WithClock(clk))
+	defer l1.Stop()
+	mustAcquire(t, l1).Release()
+	w.release()
+
+	// 0 has processed the ghosts by the time it is granted the lock, as
+	// they precede 1's acks on the same channel
+	g := mustAcquire(t, l0)
+	l0.lock.Lock()
+	gone, queued := l0.gone[1], l0.reqs.Len()
+	l0.lock.Unlock()
+	g.Release()
+	if gone {
+		t.Error("ghost Depart marked the rejoined process as gone")
+	}
+	if queued != 1 {
+		t.Errorf("%d requests queued while holding, want 1 (ghost request queued)", queued)
+	}
+	mustAcquire(t, l1).Release()
+}
+
+// Incarnations increase across restarts even if the clock steps backwards
+// (with a store) or does not move at all
+func TestIncarnationIncreases(t *testing.T) {
+	clk := newFakeClock()
+	store := newMemStore()
+	chns := localChannels(1)
+
+	a := Start(0, chns, WithClock(clk), WithClockStore(store, 1))
+	a.Stop()
+	b := Start(0, chns, WithClock(clk), WithClockStore(store, 1))
+	b.Stop()
+	if b.incn <= a.incn {
+		t.Errorf("restart with an unchanged clock got incarnation %d after %d", b.incn, a.incn)
+	}
+
+	// a stepped-back clock, in a fresh program: only the store remembers
+	lastIncarnation = 0
+	clk.Advance(-time.Hour)
+	c := Start(0, chns, WithClock(clk), WithClockStore(store, 1))
+	c.Stop()
+	if c.incn <= b.incn {
+		t.Errorf("restart after the clock stepped back got incarnation %d after %d", c.incn, b.incn)
+	}
+}
+
+// A rejoined process learns of the live holder from its peers' replies,
+// entering only once the holder releases, with a token after the holder's
+func TestRejoinWaitsForHolder(t *testing.T) {
+	chns := localChannels(3)
+	l0, l2 := Start(0, chns), Start(2, chns)
+	defer l0.Stop()
+	defer l2.Stop()
+	old := Start(1, chns)
+	mustAcquire(t, old).Release()
+	old.Stop()
+
+	g := mustAcquire(t, l0)
+	l1 := Rejoin(1, chns)
+	defer l1.Stop()
+	got := make(chan *Guard, 1)
+	go func() {
+		g, _ := l1.Acquire()
+		got <- g
+	}()
+	select {
+	case <-got:
+		t.Fatal("rejoined process granted lock alongside the live holder")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	g.Release()
+	select {
+	case g1 := <-got:
+		if g1.Token() <= g.Token() {
+			t.Errorf("rejoined process granted token %d after %d", g1.Token(), g.Token())
+		}
+		g1.Release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("rejoined process not granted lock once the holder released")
+	}
+}
@@ -0,0 +1,45 @@
+package lamport
+
+import "log"
+
+// Deliver message m to process to
+type Handler func(to int, m Message)
+
+// Wrap a Handler, e.g. to log, count, validate, transform or drop messages
+// (see WithInbound and WithOutbound)
+type Interceptor func(next Handler) Handler
+
+// Apply interceptors to h, the first outermost
+func chain(h Handler, ics []Interceptor) Handler {
+	for i := len(ics) - 1; i >= 0; i-- {
+		h = ics[i](h)
+	}
+	return h
+}
+
+// Build the inbound and outbound handler chains, stamping our incarnation,
+// tracing (see Trace) and persisting the clock (see WithClockStore) ahead of
+// any outbound interceptors
+func (state *LamportLockState) initHandlers() {
+	outbound := []Interceptor{state.stampIncarnation, state.traceSent}
+	if state.opts.store != nil {
+		outbound = append(outbound, state.reserveClock)
+	}
+	outbound = append(outbound, state.opts.outbound...)
+	state.recv = chain(func(to int, m Message) {
+		if err := state.validate(m); err != nil {
+			log.Printf("lamport: process %d dropped malformed message: %v", state.proc, err)
+			return
+		}
+		state.inbox(m)
+	}, state.opts.inbound)
+	state.xmit = chain(func(to int, m Message) {
+		state.chns[to] <- m
+	}, outbound)
+	state.xlsy = chain(func(to int, m Message) {
+		select {
+		case state.chns[to] <- m:
+		default:
+		}
+	}, outbound)
+}
@@ -0,0 +1,27 @@
+package lamport
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// Outbound interceptor holding up requests (only) in transit, for up to d
+func delayRequests(d time.Duration) Interceptor {
+	return func(next Handler) Handler {
+		return func(to int, m Message) {
+			if m.Type == MessageRequest {
+				time.Sleep(time.Duration(rand.Int63n(int64(d))))
+			}
+			next(to, m)
+		}
+	}
+}
+
+// A slow outbound interceptor delays a request without letting the
+// messages stamped after it overtake it
+func TestOutboundOrder(t *testing.T) {
+	ls := NewLocalCluster(2, WithOutbound(delayRequests(5*time.Millisecond)))
+	defer stopAll(ls)
+	checkHolders(t, ls, 1, 100)
+}
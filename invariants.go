@@ -0,0 +1,57 @@
+package lamport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Check internal invariants, if enabled (see WithInvariants), panicking
+// with a dump of the state on violation
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) checkInvariants() {
+	if !state.opts.invariants {
+		return
+	}
+	if err := state.violation(); err != nil {
+		var b strings.Builder
+		state.dump(&b)
+		panic(fmt.Sprintf("lamport: process %d: invariant violated: %v\n%s", state.proc, err, b.String()))
+	}
+	state.chkt = state.time
+}
+
+// Describe the first invariant the state violates, if any
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) violation() error {
+	// the clock never runs backwards, and is ahead of every peer's we have
+	// seen
+	if state.time < state.chkt {
+		return fmt.Errorf("clock went back from %d to %d", state.chkt, state.time)
+	}
+	for p, t := range state.seen {
+		if t > state.time {
+			return fmt.Errorf("seen time %d of process %d is ahead of clock %d", t, p, state.time)
+		}
+	}
+
+	// the queue is heap-ordered, holding at most one request per process
+	reqs := *state.reqs
+	queued := make(map[int]bool)
+	for i, req := range reqs {
+		for _, c := range []int{2*i + 1, 2*i + 2} {
+			if c < len(reqs) && reqs.Less(c, i) {
+				return fmt.Errorf("queue out of heap order at %d", c)
+			}
+		}
+		if queued[req.Proc] {
+			return fmt.Errorf("process %d has several queued requests", req.Proc)
+		}
+		queued[req.Proc] = true
+	}
+
+	// we believe ourselves the holder only with a request at the head
+	if state.held != nil && !state.holdsLock() {
+		return fmt.Errorf("guard held (token %d) without the lock", state.held.token)
+	}
+	return nil
+}
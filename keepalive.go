@@ -0,0 +1,32 @@
+package lamport
+
+// Broadcast a keepalive if one is due (threadsafe)
+// Keepalives carry no state beyond our logical time, so they are dropped
+// rather than blocking the service loop when a peer's channel is full.
+func (state *LamportLockState) sendKeepalive() {
+	// lock state struct (mutating time)
+	state.lock.Lock()
+
+	// check whether a keepalive is due
+	k := state.opts.keepalive
+	now := state.opts.clock.Now()
+	if k <= 0 || state.stop || now.Sub(state.kpat) < k {
+		state.lock.Unlock()
+		return
+	}
+	state.kpat = now
+
+	// advance logical time, initialize message
+	state.time += 1
+	m := Message{
+		Type: MessageKeepalive,
+		Time: state.time,
+		Proc: state.proc}
+	state.postLossy(m)
+
+	// release
+	state.lock.Unlock()
+
+	// send keepalive message
+	state.flush()
+}
@@ -2,16 +2,35 @@ package lamport
 
 import (
 	"container/heap"
-	"log"
+	"context"
+	"errors"
+	"runtime/debug"
 	"sync"
 	"time"
 )
 
-// Sleep time used in:
-//  - polling for lock acquisition
-//  - servicing incoming messages
+// Sleep time used in periodic checks by the service loop, while messages
+// are flowing
 const SleepTime = 10 * time.Millisecond
 
+// Longest Stop waits for the holder to release the lock, before releasing
+// it regardless (see StopContext)
+const StopTimeout = 10 * time.Second
+
+// Longest the service loop waits between periodic checks when idle (the
+// interval backs off from SleepTime while no messages arrive)
+const MaxIdleTime = LivenessTimeout / 4
+
+// Most inbound messages serviced in one batch, under a single acquisition
+// of the state lock
+const MaxBatch = 64
+
+// Returned by Acquire once the lock has been stopped
+var ErrStopped = errors.New("lamport: lock stopped")
+
+// Returned by Acquire on an observer process (see WithObserver)
+var ErrObserver = errors.New("lamport: observers cannot acquire the lock")
+
 // Structure representing internal state of distributed lock
 type LamportLockState struct {
 	time int
@@ -20,119 +39,355 @@ type LamportLockState struct {
 	chns []chan Message
 	reqs *MessageHeap
 	lock sync.Mutex
+	last time.Time        // time of last service loop iteration
+	gone []bool           // departed peers (see Stop)
+	live []int            // peers that have not departed (see postAll)
+	prio int              // removed requests preceding our pending one (see grant)
+	rmvd int              // total removed requests
+	held *Guard           // guard for the current grant, if any
+	open chan struct{}    // closed once the latch is opened (see Latch)
+	data interface{}      // latest guarded value (see GuardedValue)
+	dtok int              // fencing token of the grant that shipped data
+	stat stats            // latency distributions (see Stats)
+	rqat time.Time        // time our pending request was sent
+	ackd []bool           // peers that have acked our pending request
+	late []int            // acks still due for retracted requests, per peer
+	slnt []bool           // peers silent past the partition timeout (see Health)
+	hear []time.Time      // time each peer was last heard from
+	kpat time.Time        // time our last keepalive was sent
+	hbat time.Time        // time our last holder heartbeat was sent
+	beat []time.Time      // time of each peer's last holder heartbeat
+	head int              // process at the head of the queue (-1 if empty)
+	hdat time.Time        // time head reached the head of the queue
+	stop bool             // set once Stop is called
+	audt chan AuditRecord // pending audit records (see WithAudit)
+	adon chan struct{}    // closed once audit records are flushed
+	reqn []int            // requests seen from each process (see Rejoin)
+	wait []bool           // peers yet to reply to our join (see Rejoin)
+	join chan struct{}    // closed once joined (see Rejoin)
+	rlim bucket           // outgoing request limit (see WithRateLimit)
+	plim []bucket         // per-peer request limits (see WithPeerRateLimit)
+	pack []pendingAck     // acks held back by per-peer limits
+	recv Handler          // inbound handler chain (see WithInbound)
+	xmit Handler          // outbound handler chain (see WithOutbound)
+	xlsy Handler          // outbound chain dropping sends to full channels
+	subs []chan Event     // event subscribers (see Subscribe)
+	qver int              // version of reqs, bumped on every change
+	ptim int              // time as of the last published event
+	pver int              // version of reqs as of the last published event
+	nckd bool             // our pending request was rejected (see WithMessageTTL)
+	evct bool             // our pending request was evicted (see ForceRelease)
+	ceil int              // persisted bound on our timestamps (see WithClockStore)
+	clck sync.Mutex       // guards ceil, as messages are sent outside lock
+	chkt int              // time as of the last invariant check
+	rtrn int              // consecutive retracted requests (see awaitBackoff)
+	rtat time.Time        // time the last request was retracted
+	inbx []Message        // inbound messages awaiting service (see serve)
+	ilck sync.Mutex       // guards inbx, filled by the inbound chain
+	kick chan struct{}    // signals inbx filled outside serve
+	gsig chan struct{}    // signals our pending request can proceed (see notifyWaiter)
+	idlr bool             // pending request is conditional (see AcquireIfIdle)
+	prog bool             // waiter wants its queue position (see AcquireProgress)
+	posn int              // queue position last reported to the waiter
+	hreq Message          // request at the head of the queue (zero if empty)
+	hrat time.Time        // time hreq reached the head of the queue
+	turn time.Duration    // moving average of time requests spend at the head
+	incn int64            // our incarnation (see Rejoin)
+	pinc []int64          // latest incarnation heard from each peer
+	trce []TraceEntry     // ring of recent protocol events (see Trace)
+	tpos int              // next slot in trce
+	tful bool             // trce has wrapped around
+	tlck sync.Mutex       // guards trce, as messages are sent outside lock
+	fdet FailureDetector  // our failure detector, if any (see WithFailureDetector)
+	outb []outMsg         // outbound messages awaiting delivery (see post)
+	olck sync.Mutex       // held while delivering outb, to keep it in order
+	xfrd []int            // time of each peer's request queued by a transfer before it arrived
+	quit chan struct{}
+	done chan struct{}
+	opts options
 }
 
 // Initialize the LamportLockState structure
-func initState(p int, chns []chan Message) *LamportLockState {
+func initState(p int, chns []chan Message, opts options) *LamportLockState {
 	s := LamportLockState{
 		time: 1,
 		proc: p,
 		seen: make([]int, len(chns)),
 		chns: chns,
-		reqs: &MessageHeap{}}
+		reqs: &MessageHeap{},
+		gone: make([]bool, len(chns)),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+		open: make(chan struct{}),
+		ackd: make([]bool, len(chns)),
+		late: make([]int, len(chns)),
+		slnt: make([]bool, len(chns)),
+		hear: make([]time.Time, len(chns)),
+		pinc: make([]int64, len(chns)),
+		beat: make([]time.Time, len(chns)),
+		reqn: make([]int, len(chns)),
+		xfrd: make([]int, len(chns)),
+		wait: make([]bool, len(chns)),
+		join: make(chan struct{}),
+		kick: make(chan struct{}, 1),
+		gsig: make(chan struct{}, 1),
+		rlim: newBucket(opts.rate, opts.burst),
+		plim: make([]bucket, len(chns)),
+		trce: make([]TraceEntry, opts.trace),
+		head: -1,
+		opts: opts}
+	s.stat.peer = make([]peerStats, len(chns))
+	for p := range s.plim {
+		s.plim[p] = newBucket(opts.peerRate, opts.peerBurst)
+	}
+	if opts.detector != nil {
+		s.fdet = opts.detector(p)
+	}
+	s.restoreClock()
+	s.incn = s.newIncarnation()
+	s.initHandlers()
+	s.updateLive()
 	heap.Init(s.reqs)
+	for p := range s.hear {
+		s.hear[p] = opts.clock.Now()
+	}
 	return &s
 }
 
-// Broadcast a message to all peers
-func (state *LamportLockState) bcast(m Message) {
-	for p, chn := range state.chns {
-		if p != state.proc {
-			chn <- m
+// Rebuild the list of peers that have not departed, after a change
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) updateLive() {
+	peers := make([]int, 0, len(state.chns))
+	for p := range state.chns {
+		if p != state.proc && !state.gone[p] {
+			peers = append(peers, p)
 		}
 	}
+	state.live = peers
 }
 
 // Send request to all other procs and it enqueue locally (threadsafe)
-func (state *LamportLockState) sendRequestMsg() {
+// Returns the logical time of the request.
+func (state *LamportLockState) sendRequestMsg(session string, meta map[string]string) (int, error) {
+	// refuse a request that peers would drop (see validate)
+	if err := checkRequest(session, meta); err != nil {
+		return 0, err
+	}
+
 	// lock state struct (mutating time and reqs)
 	state.lock.Lock()
 
+	// no new requests once stopped, or ever from an observer
+	if state.stop {
+		state.lock.Unlock()
+		return 0, ErrStopped
+	}
+	if state.opts.observer {
+		state.lock.Unlock()
+		return 0, ErrObserver
+	}
+
 	// advance logical time, initialize message, enqueue
 	state.time += 1
 	m := Message{
 		Type: MessageRequest,
 		Time: state.time,
-		Proc: state.proc}
-	heap.Push(state.reqs, m)
+		Proc: state.proc,
+		Sess: session,
+		Meta: meta}
+	state.reqs.push(m)
+	state.reqn[state.proc] += 1
+	state.qver += 1
+
+	// all requests removed so far precede this one (see grant)
+	state.prio = state.rmvd
+	state.nckd = false
+	state.evct = false
+	state.idlr = false
+	state.prog = false
+	state.requestSent()
+	state.publish()
+	state.postAll(m)
 
 	// release
 	state.lock.Unlock()
 
 	// send request message
-	state.bcast(m)
+	state.flush()
+	return m.Time, nil
 }
 
 // Send release to all other procs and dequeue locally (threadsafe)
-func (state *LamportLockState) sendReleaseMsg() {
-	// check to make sure we really have the lock
-	if ! state.haveLock() {
-		log.Fatal("Cannot send release if we do not have the lock")
-	}
-
+// Note that when sharing the lock in a session, our request need not be the
+// head of the queue.
+func (state *LamportLockState) sendReleaseMsg(g *Guard) error {
 	// lock state struct (mutating time and reqs)
 	state.lock.Lock()
 
+	// check to make sure we really have the lock: Stop may already have
+	// released it, otherwise it has been lost (e.g. evicted)
+	if state.held != g {
+		stopped := state.stop
+		state.lock.Unlock()
+		if stopped {
+			return nil
+		}
+		return ErrNotHeld
+	}
+
 	// advance logical time, initialize message, dequeue top of heap
 	state.time += 1
 	m := Message{
 		Type: MessageRelease,
 		Time: state.time,
-		Proc: state.proc}
-	heap.Pop(state.reqs)
+		Proc: state.proc,
+		Meta: state.ownMeta()}
+	state.shipData(&m)
+	state.abandonAcks(false)
+	state.removeRequests(state.proc)
+	state.dropGuard(AuditRelease)
+	state.publish()
+	state.postAll(m)
 
 	// release
 	state.lock.Unlock()
 
 	// send release message
-	state.bcast(m)
+	state.flush()
+	return nil
 }
 
-// Send an acknowledgement message
+// Send an acknowledgement message, echoing the request's metadata
 // Not threadsafe on its own: called only from processMessage
-func (state *LamportLockState) sendAckMsg(target int) {
+func (state *LamportLockState) sendAckMsg(target int, meta map[string]string) {
 	// advance logical time
 	state.time += 1
 
 	// initialize ack message and send
-	r := Message{Type: MessageAck, Time: state.time, Proc: state.proc}
-	state.chns[target] <- r
+	r := Message{Type: MessageAck, Time: state.time, Proc: state.proc, Meta: meta}
+	state.post(target, r)
+}
+
+// Find the index of our own queued request, if any
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) ownRequest() (int, bool) {
+	for i, req := range *state.reqs {
+		if req.Proc == state.proc {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Remove all queued requests originating from proc, counting those that
+// precede our own pending request (see grant)
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) removeRequests(proc int) {
+	i, pending := state.ownRequest()
+	var mine Message
+	if pending {
+		mine = (*state.reqs)[i]
+	}
+	// filter in place, clearing the tail so removed requests can be freed
+	reqs := *state.reqs
+	kept := reqs[:0]
+	for _, req := range reqs {
+		if req.Proc != proc {
+			kept = append(kept, req)
+		} else {
+			state.rmvd += 1
+			state.qver += 1
+			if pending && req.Proc != state.proc && req.before(mine) {
+				state.prio += 1
+			}
+		}
+	}
+	for i := len(kept); i < len(reqs); i++ {
+		reqs[i] = Message{}
+	}
+	*state.reqs = kept
+	heap.Init(state.reqs)
 }
 
 // Process the current message, updating time vector and heap
-// Not threadsafe on its own: called only from serviceMessage (within locked region)
+// Not threadsafe on its own: called only from serviceMessages (within locked region)
 func (state *LamportLockState) processMessage(m Message) {
-	// update the process-time vector and current time
-	state.seen[m.Proc] = m.Time
+	// update the process-time vector (which may already be ahead, if the
+	// peer is joining, see Rejoin) and current time
+	if m.Time > state.seen[m.Proc] {
+		state.seen[m.Proc] = m.Time
+	}
 	if m.Time > state.time {
 		state.time = m.Time
 	}
+	state.slnt[m.Proc] = false
+	state.hear[m.Proc] = state.opts.clock.Now()
+	if fd := state.fdet; fd != nil {
+		fd.Heard(m.Proc, state.hear[m.Proc])
+	}
 
 	// if needed (i.e. not just a MessageAck), update request heap
-	if m.Type == MessageRequest {
-		// new request: add to queue
-		heap.Push(state.reqs, m)
-		// reply with an acknowledgement
-		state.sendAckMsg(m.Proc)
+	if m.Type == MessageAck {
+		state.ackReceived(m.Proc)
+	} else if m.Type == MessageRequest && m.Time == state.xfrd[m.Proc] {
+		// request already queued by a transfer that overtook it (see
+		// transferRequest): only acknowledge it
+		state.xfrd[m.Proc] = 0
+		state.ackRequest(m)
+	} else if m.Type == MessageRequest && state.staleRequest(m) {
+		// request too old to grant in order: reject it
+		state.rejectRequest(m)
+	} else if m.Type == MessageRequest {
+		// new request: add to queue, superseding any earlier one from the
+		// same process (whose release or retract we must have missed)
+		state.removeRequests(m.Proc)
+		state.reqs.push(m)
+		state.reqn[m.Proc] += 1
+		state.qver += 1
+		// reply with an acknowledgement (see WithPeerRateLimit)
+		state.ackRequest(m)
 	} else if m.Type == MessageRelease {
 		// release previous request: remove all matching entries
-		kept := make([]Message, 0)
-		for state.reqs.Len() > 0 {
-			req := heap.Pop(state.reqs).(Message)
-			if req.Proc != m.Proc {
-				kept = append(kept, req)
-			}
-		}
-		for _, req := range kept {
-			heap.Push(state.reqs, req)
-		}
+		state.removeRequests(m.Proc)
+		state.recvData(m)
+	} else if m.Type == MessageRetract {
+		// withdraw request that was never granted
+		state.removeRequests(m.Proc)
+	} else if m.Type == MessageDepart {
+		// peer has left: drop its requests and stop waiting on it
+		state.removeRequests(m.Proc)
+		state.gone[m.Proc] = true
+		state.updateLive()
+	} else if m.Type == MessageTransfer {
+		// holder has handed the lock to another process
+		state.transferRequest(m.Proc, *m.Rqst, m.Tokn)
+		state.recvData(m)
+	} else if m.Type == MessageEvict {
+		// administrator has forcibly released a (stuck) holder
+		state.evict(m)
+	} else if m.Type == MessageHeartbeat {
+		// holder is still active
+		state.beat[m.Proc] = state.opts.clock.Now()
+	} else if m.Type == MessageOpen {
+		// a peer has opened the latch
+		state.openLatch()
+	} else if m.Type == MessageNack {
+		// a peer has rejected our request as stale
+		state.nackReceived(m.Proc)
+	} else if m.Type == MessageJoin {
+		// a peer has restarted: bring it up to date
+		state.joinPeer(m.Proc)
+	} else if m.Type == MessageState {
+		// a peer has replied to our join
+		state.recvJoinState(m)
 	}
 }
 
-// Check if all *other* processes have advanced to later logical times
+// Check if all *other* (non-departed) processes have advanced to later
+// logical times
 func (state *LamportLockState) allProcessesSeen(time int) bool {
 	for p := range state.seen {
-		if p != state.proc {
+		if p != state.proc && !state.gone[p] {
 			if state.seen[p] < time {
 				return false
 			}
@@ -141,57 +396,358 @@ func (state *LamportLockState) allProcessesSeen(time int) bool {
 	return true
 }
 
-// Check whether the current process has the lock
-func (state *LamportLockState) haveLock() bool {
-	// peek at the head of the queue
-	state.lock.Lock()
-	if state.reqs.Len() > 0 {
-		m := (*state.reqs)[0]
-		if m.Proc == state.proc {
-			if state.allProcessesSeen(m.Time) {
-				state.lock.Unlock()
-				return true
+// Check whether the current process has the lock, i.e. whether fewer
+// requests than the number of holders are ahead of ours, or every request
+// ahead of ours is in the same (non-exclusive) session
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) holdsLock() bool {
+	// find our request
+	mine, ok := state.ownRequest()
+	if !ok {
+		return false
+	}
+	m := (*state.reqs)[mine]
+
+	// check for conflicting requests ahead of it
+	ahead, conflict := 0, false
+	for i, req := range *state.reqs {
+		if state.reqs.Less(i, mine) {
+			ahead += 1
+			if m.Sess == "" || req.Sess != m.Sess {
+				conflict = true
 			}
 		}
 	}
-	state.lock.Unlock()
-	return false
+	if conflict && ahead >= state.opts.holders {
+		return false
+	}
+	// a rejected request is never granted: the peer that nacked it counts
+	// as having replied (see nackReceived), but did not queue it
+	if state.opts.ttl > 0 && (state.nckd || !state.allAcked()) {
+		return false
+	}
+	return state.allProcessesSeen(m.Time)
+}
+
+// Count the queued requests ahead of our own
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) requestsAhead() int {
+	mine, ok := state.ownRequest()
+	if !ok {
+		return 0
+	}
+	n := 0
+	for i := range *state.reqs {
+		if state.reqs.Less(i, mine) {
+			n += 1
+		}
+	}
+	return n
 }
 
-// Service one incoming message
-func (state *LamportLockState) serviceMessage() {
+// Check whether the current process has the lock (threadsafe)
+func (state *LamportLockState) haveLock() bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.holdsLock()
+}
+
+// Service a batch of incoming messages (possibly empty), then run periodic
+// checks
+func (state *LamportLockState) serviceMessages(ms []Message) {
 	// lock the state structure
 	state.lock.Lock()
 
-	// attempt non-blocking recv from incoming channel
-	select {
-	case m := <-state.chns[state.proc]:
+	// process the messages, in order of arrival, dropping any from a
+	// previous incarnation of their origin
+	for _, m := range ms {
+		if !state.currentIncarnation(m) {
+			continue
+		}
+		if len(state.subs) > 0 {
+			state.emit(MessageEvent{Message: m})
+		}
+		state.traceReceived(m)
 		state.processMessage(m)
-	default:
 	}
 
-	// unlock the state structure
+	// complete a pending join once every live peer has replied
+	state.checkJoined()
+
+	// send any held-back acks now due
+	state.flushAcks(-1)
+
+	// notify the holder if the messages cost us the lock
+	if state.held != nil && !state.holdsLock() {
+		state.dropGuard(AuditLost)
+	}
+
+	// track how long the head of the queue has been there (see Holder)
+	state.updateHead()
+	state.timeTurn()
+
+	// check for forgotten releases and unreachable peers
+	state.checkLongHold()
+	state.checkPartition()
+
+	// record service loop progress (see Alive)
+	state.last = state.opts.clock.Now()
+	state.publish()
+
+	// unlock the state structure, then send any replies
 	state.lock.Unlock()
+	state.flush()
+}
+
+// Check whether Stop has been called (threadsafe)
+func (state *LamportLockState) stopped() bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.stop
+}
+
+// Check whether the current process has the lock, returning a new Guard
+// for the grant if so (threadsafe)
+func (state *LamportLockState) grant() *Guard {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if !state.holdsLock() {
+		return nil
+	}
+	return state.newGuard()
+}
+
+// Take the lock for our pending request, returning its new Guard
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) newGuard() *Guard {
+	state.rtrn = 0
+	// our token is the rank of our request in the total order: we have
+	// seen every request preceding it, either removed (counted in prio) or
+	// still queued ahead, so tokens are distinct and follow queue order
+	state.held = &Guard{
+		state: state,
+		token: state.prio + state.requestsAhead() + 1,
+		meta:  state.ownMeta(),
+		at:    state.opts.clock.Now(),
+		done:  make(chan struct{})}
+	if state.opts.longHold > 0 {
+		state.held.stack = debug.Stack()
+	}
+	state.emit(GrantEvent{Time: state.time, Token: state.held.token})
+	state.traceLocal("granted token %d", state.held.token)
+	mine, _ := state.ownRequest()
+	state.audit(AuditRecord{
+		Kind:  AuditAcquire,
+		Proc:  state.proc,
+		By:    state.proc,
+		Req:   (*state.reqs)[mine].Time,
+		Token: state.held.token,
+		Meta:  state.held.meta})
+	return state.held
+}
+
+// Acquire the distributed lock, returning a Guard used to release it
+// Returns ErrStopped if the lock is (or becomes) stopped before acquisition,
+// a *ProgressError if peers fail to acknowledge the request within the
+// configured ack timeout (see WithAckTimeout), or ErrPartitioned if some
+// peers are unreachable (see WithPartitionTimeout), or ErrStale if a peer
+// rejects the request as too old (see WithMessageTTL); in the latter cases
+// the request is retracted, and re-requested if a retry policy is configured
+// (see WithRetryPolicy). Returns ErrEvicted, without retrying, if the
+// request is evicted (see ForceRelease), and ErrTooLarge, without
+// requesting, if its session or metadata exceed the payload limits (see
+// MaxSessionLen).
+func (state *LamportLockState) Acquire() (*Guard, error) {
+	return state.AcquireSession("")
+}
+
+// Acquire the distributed lock in the named session
+// Processes requesting the same session (e.g. "readers of shard A") may
+// hold the lock concurrently, while different sessions are serialized in
+// request order. The empty session is exclusive, as with Acquire.
+func (state *LamportLockState) AcquireSession(session string) (*Guard, error) {
+	return state.acquire(context.Background(), session, nil, nil)
+}
+
+// Acquire the distributed lock, giving up once ctx is done
+// On cancellation, the pending request is retracted and ctx.Err() returned.
+// Once granted, the guard's Context derives from ctx (see Guard.Context).
+func (state *LamportLockState) AcquireContext(ctx context.Context) (*Guard, error) {
+	return state.acquire(ctx, "", nil, nil)
+}
+
+// Acquire the distributed lock in the given session, with request metadata,
+// re-requesting under the retry policy (if any) when a request is retracted
+// and reporting our place in the queue to progress (if non-nil)
+func (state *LamportLockState) acquire(ctx context.Context, session string, meta map[string]string, progress func(Position)) (*Guard, error) {
+	for attempt := 1; ; attempt++ {
+		g, err := state.request(ctx, session, meta, progress)
+		retry := state.current().retry
+		if !retryable(err) || retry == nil {
+			return g, err
+		}
+		// the next request backs off (see awaitBackoff)
+		if _, ok := retry.Next(attempt); !ok {
+			return nil, err
+		}
+	}
 }
 
-// Acquire the distributed lock
-func (state *LamportLockState) Acquire() {
+// Make a single request for the lock and wait for it to be granted
+func (state *LamportLockState) request(ctx context.Context, session string, meta map[string]string, progress func(Position)) (*Guard, error) {
+	// wait until we have joined the group, if restarting (see Rejoin)
+	select {
+	case <-state.join:
+	case <-state.quit:
+		return nil, ErrStopped
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if err := state.awaitBackoff(ctx); err != nil {
+		return nil, err
+	}
+	if err := state.awaitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
 	// initiate new request
-	state.sendRequestMsg()
+	t, err := state.sendRequestMsg(session, meta)
+	if err != nil {
+		return nil, err
+	}
+	sent := state.opts.clock.Now()
 
 	// now wait for acquisition ...
 	for {
-		ready := state.haveLock()
-		if ready {
-			return
+		if g := state.grant(); g != nil {
+			state.stat.acquired(g.at.Sub(sent))
+			g.from = ctx
+			return g, nil
+		}
+		if progress != nil {
+			if pos, ok := state.position(); ok {
+				progress(pos)
+			}
+		}
+		if state.stopped() {
+			return nil, ErrStopped
+		}
+		if err := ctx.Err(); err != nil {
+			state.retractRequest()
+			return nil, err
+		}
+		if state.nacked() {
+			state.retractRequest()
+			return nil, ErrStale
+		}
+		if state.evicted() {
+			// a peer that saw the eviction before our request queued it
+			// anyway: withdraw it there too (FIFO delivers the retraction
+			// after the request, and peers that purged it remove nothing)
+			state.retractRequest()
+			return nil, ErrEvicted
+		}
+		if timeout := state.current().ackTimeout; timeout > 0 && state.opts.clock.Now().Sub(sent) > timeout {
+			if peers := state.unresponsivePeers(t); len(peers) > 0 {
+				state.retractRequest()
+				return nil, &ProgressError{Peers: peers, Trace: state.Trace()}
+			}
+		}
+		if state.Health().Degraded {
+			state.retractRequest()
+			return nil, ErrPartitioned
 		}
-		time.Sleep(SleepTime)
+		state.awaitProgress(ctx, sent)
 	}
 }
 
-// Release the distributed lock
-func (state *LamportLockState) Release() {
-	state.sendReleaseMsg()
+// Drain and stop the distributed lock, as StopContext with a deadline of
+// StopTimeout
+func (state *LamportLockState) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), StopTimeout)
+	defer cancel()
+	state.StopContext(ctx)
+}
+
+// Drain and stop the distributed lock, by:
+//  - waiting for the holder (if any) to release the lock, until ctx is
+//    done, after which the lock is released regardless (aborting the
+//    current critical section; the holder's subsequent Guard.Release is a
+//    no-op) and ctx.Err() returned
+//  - retracting any pending request
+//  - announcing departure, so that peers no longer wait on this process
+//  - stopping the progress goroutine
+// Pending and subsequent Acquire() calls return ErrStopped. A holder that
+// calls Stop before releasing the lock waits out its own deadline, and
+// should release first (or abort the critical section via Guard.Done).
+func (state *LamportLockState) StopContext(ctx context.Context) error {
+	// lock state struct (mutating time and reqs)
+	state.lock.Lock()
+	if state.stop {
+		state.lock.Unlock()
+		return nil
+	}
+	state.stop = true
+
+	// give the holder until ctx is done to release (the service loop keeps
+	// running meanwhile, so we neither stall peers nor lose the lock)
+	if g := state.held; g != nil {
+		state.lock.Unlock()
+		select {
+		case <-g.done:
+		case <-ctx.Done():
+		}
+		state.lock.Lock()
+	}
+	var err error
+	if state.held != nil {
+		err = ctx.Err()
+	}
+
+	// release if still held, otherwise retract any pending request
+	t := MessageRetract
+	if state.holdsLock() {
+		t = MessageRelease
+	}
+	if _, ok := state.ownRequest(); ok {
+		state.abandonAcks(t == MessageRetract)
+	}
+
+	// advance logical time, initialize release and departure messages
+	state.time += 1
+	r := Message{
+		Type: t,
+		Time: state.time,
+		Proc: state.proc,
+		Meta: state.ownMeta()}
+	if t == MessageRelease {
+		state.shipData(&r)
+	}
+	state.dropGuard(AuditRelease)
+
+	// drop our own (held or pending) request locally
+	state.removeRequests(state.proc)
+	state.time += 1
+	d := Message{
+		Type: MessageDepart,
+		Time: state.time,
+		Proc: state.proc}
+	state.publish()
+	state.postAll(r)
+	state.postAll(d)
+
+	// release
+	state.lock.Unlock()
+
+	// release / retract, then announce departure
+	state.flush()
+
+	// stop the progress routine and wait for it to exit
+	close(state.quit)
+	<-state.done
+	state.stopAudit()
+	state.closeSubs()
+	return err
 }
 
 // Initialize the Lamport distributed lock, by:
@@ -199,18 +755,86 @@ func (state *LamportLockState) Release() {
 //  - spinning up the progress goroutine
 // The supplied array of channels are assumed to be *buffered* such that
 // simultaneous Acquire() calls will not induce deadlock.
-func Start(p int, chns []chan Message) *LamportLockState {
+func Start(p int, chns []chan Message, opts ...Option) *LamportLockState {
 	// initialize distributed lock state
-	state := initState(p, chns)
+	state := initState(p, chns, newOptions(opts))
+	close(state.join)
+	state.startAudit()
 
 	// spin up progess routine
-	go func(s *LamportLockState) {
-		for {
-			s.serviceMessage()
-			time.Sleep(SleepTime)
-		}
-	}(state)
+	go state.serve()
 
 	// return the state struct
 	return state
 }
+
+// Run the progress routine until stopped
+func (state *LamportLockState) serve() {
+	defer close(state.done)
+	idle := SleepTime
+	var wake <-chan time.Time
+	var due time.Time
+	var spare []Message
+	for {
+		// block until a message arrives, waking for periodic checks
+		// less often the longer we have been idle (re-arming the wakeup
+		// only if it is now due sooner, rather than on every message)
+		if now := state.opts.clock.Now(); wake == nil || due.After(now.Add(idle)) {
+			wake, due = state.opts.clock.After(idle), now.Add(idle)
+		}
+		select {
+		case <-state.quit:
+			return
+		case m := <-state.chns[state.proc]:
+			// pass on whatever else has arrived too, servicing the lot
+			// under a single acquisition of the state lock
+			state.recv(state.proc, m)
+		drain:
+			for i := 1; i < MaxBatch; i++ {
+				select {
+				case m := <-state.chns[state.proc]:
+					state.recv(state.proc, m)
+				default:
+					break drain
+				}
+			}
+			if spare = state.takeInbox(spare); len(spare) > 0 {
+				state.serviceMessages(spare)
+			}
+			idle = SleepTime
+			if b := state.opts.ackBatch; b > 0 && idle > b && state.acksPending() {
+				// wake in time to flush batched acks
+				idle = b
+			}
+		case <-state.kick:
+			// messages passed on later by an inbound interceptor
+			if spare = state.takeInbox(spare); len(spare) > 0 {
+				state.serviceMessages(spare)
+			}
+		case <-wake:
+			wake = nil
+			state.serviceMessages(nil)
+			if idle *= 2; idle > MaxIdleTime {
+				idle = MaxIdleTime
+			}
+			o := state.current()
+			if k := o.keepalive; k > 0 && idle > k {
+				idle = k
+			}
+			if h := o.heartbeat; h > 0 && idle > h {
+				idle = h
+			}
+			if b := o.ackBatch; b > 0 && idle > b && state.acksPending() {
+				idle = b
+			}
+			if r := o.peerRate; r > 0 {
+				// wake in time to send held-back acks
+				if d := time.Duration(float64(time.Second) / r); idle > d {
+					idle = d
+				}
+			}
+		}
+		state.sendKeepalive()
+		state.sendHeartbeat()
+	}
+}
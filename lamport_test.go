@@ -0,0 +1,169 @@
+package lamport
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Stop every process of a cluster
+func stopAll(ls []*LamportLockState) {
+	for _, l := range ls {
+		l.Stop()
+	}
+}
+
+// Wait for cond to hold, failing the test if it does not within a few
+// seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Acquire the lock, failing the test if it is not granted within a few
+// seconds
+func mustAcquire(t *testing.T, l *LamportLockState) *Guard {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	g, err := l.AcquireContext(ctx)
+	if err != nil {
+		t.Fatalf("process %d: acquire failed: %v", l.proc, err)
+	}
+	return g
+}
+
+// Have every process take the lock n times, failing the test if more than
+// k ever hold it at once
+func checkHolders(t *testing.T, ls []*LamportLockState, k, n int) {
+	t.Helper()
+	var inside, most int32
+	var wg sync.WaitGroup
+	for _, l := range ls {
+		wg.Add(1)
+		go func(l *LamportLockState) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				g := mustAcquire(t, l)
+				in := atomic.AddInt32(&inside, 1)
+				for m := atomic.LoadInt32(&most); in > m && !atomic.CompareAndSwapInt32(&most, m, in); {
+					m = atomic.LoadInt32(&most)
+				}
+				time.Sleep(50 * time.Microsecond)
+				atomic.AddInt32(&inside, -1)
+				g.Release()
+			}
+		}(l)
+	}
+	wg.Wait()
+	if int(most) > k {
+		t.Fatalf("%d processes held the lock at once, want at most %d", most, k)
+	}
+}
+
+// Number of requests in the local queue (threadsafe)
+func (state *LamportLockState) queueLen() int {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.reqs.Len()
+}
+
+// Guard for the current grant, if any (threadsafe)
+func (state *LamportLockState) heldGuard() (*Guard, bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.held, state.held != nil
+}
+
+// Clock that only moves when told to (see Clock)
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+	wait []fakeTimer
+}
+
+// Pending After on a fakeClock
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t := fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+	} else {
+		c.wait = append(c.wait, t)
+	}
+	return t.c
+}
+
+// Move the clock by d (which may be negative), firing any timers now due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	kept := c.wait[:0]
+	for _, t := range c.wait {
+		if t.at.After(c.now) {
+			kept = append(kept, t)
+		} else {
+			t.c <- c.now
+		}
+	}
+	c.wait = kept
+}
+
+// Count the timers pending on the clock
+func (c *fakeClock) pending() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.wait)
+}
+
+// Store kept in memory (see Store)
+type memStore struct {
+	lock sync.Mutex
+	data map[string][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[string][]byte)}
+}
+
+func (s *memStore) Load(key string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.data[key], nil
+}
+
+func (s *memStore) Save(key string, data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data[key] = append([]byte(nil), data...)
+	return nil
+}
@@ -0,0 +1,75 @@
+package lamport
+
+// One-shot distributed latch, shared by the processes of a lock
+// Once opened by any process, all current and future waiters across the
+// group unblock permanently (e.g. "configuration loaded").
+type Latch struct {
+	state *LamportLockState
+}
+
+// Get the latch associated with this lock's group of processes
+func (state *LamportLockState) Latch() *Latch {
+	return &Latch{state: state}
+}
+
+// Mark the latch open, if not already
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) openLatch() {
+	select {
+	case <-state.open:
+	default:
+		close(state.open)
+	}
+}
+
+// Open the latch, locally and at all peers
+func (l *Latch) Open() {
+	state := l.state
+
+	// lock state struct (mutating time)
+	state.lock.Lock()
+
+	// nothing to do if already open
+	select {
+	case <-state.open:
+		state.lock.Unlock()
+		return
+	default:
+	}
+
+	// advance logical time, initialize message, open locally
+	state.time += 1
+	m := Message{
+		Type: MessageOpen,
+		Time: state.time,
+		Proc: state.proc}
+	state.openLatch()
+	state.postAll(m)
+
+	// release
+	state.lock.Unlock()
+
+	// send open message
+	state.flush()
+}
+
+// Check whether the latch has been opened
+func (l *Latch) IsOpen() bool {
+	select {
+	case <-l.state.open:
+		return true
+	default:
+		return false
+	}
+}
+
+// Block until the latch is opened
+// Returns ErrStopped if the lock is stopped first.
+func (l *Latch) Wait() error {
+	select {
+	case <-l.state.open:
+		return nil
+	case <-l.state.quit:
+		return ErrStopped
+	}
+}
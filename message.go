@@ -1,17 +1,46 @@
 package lamport
 
+import "container/heap"
+
 // Basic message structure for Lamport lock manipulation
 type Message struct {
-	Type int // Message type
-	Proc int // Origin process
-	Time int // Logical time on origin
+	Type int               // Message type
+	Proc int               // Origin process
+	Time int               // Logical time on origin
+	Dest int               // Target process (MessageTransfer only)
+	Rqst *Message          // Target's pending request (MessageTransfer only)
+	Sess string            // Session (MessageRequest only; see AcquireSession)
+	Tokn int               // Fencing token of sender's grant (release/transfer)
+	Data interface{}       // Guarded value (release/transfer; see GuardedValue)
+	Meta map[string]string // Request metadata (see AcquireWithMetadata)
+	Auth []byte            // Admin authentication (MessageEvict only)
+	Incn int64             // Incarnation of the origin process (see Rejoin)
+}
+
+// Check whether m precedes o in the total order of requests
+func (m Message) before(o Message) bool {
+	if m.Time != o.Time {
+		return m.Time < o.Time
+	}
+	return m.Proc < o.Proc
 }
 
 // Message types
 const (
-	MessageRequest = iota // Request lock acquisition
-	MessageRelease = iota // Release currently held lock
-	MessageAck     = iota // Acknowledge lock request
+	MessageRequest   = iota // Request lock acquisition
+	MessageRelease   = iota // Release currently held lock
+	MessageAck       = iota // Acknowledge lock request
+	MessageDepart    = iota // Leave the group (see Stop)
+	MessageTransfer  = iota // Hand held lock to another process
+	MessageRetract   = iota // Withdraw request that was never granted
+	MessageOpen      = iota // Open the latch (see Latch)
+	MessageKeepalive = iota // Advance peers' view of our time (see WithKeepalive)
+	MessageHeartbeat = iota // Holder is still active (see WithHeartbeat)
+	MessageEvict     = iota // Forcibly release a holder (see ForceRelease)
+	MessageJoin      = iota // Announce a restarted process (see Rejoin)
+	MessageState     = iota // Reply to a join with our view of the group
+	MessageNack      = iota // Reject a stale request (see WithMessageTTL)
+	messageTypes     = iota // Number of message types (see validate)
 )
 
 // Implements heap.Interface from container/heap for Message
@@ -23,10 +52,7 @@ func (mh MessageHeap) Len() int {
 }
 
 func (mh MessageHeap) Less(i, j int) bool {
-	if mh[i].Time < mh[j].Time {
-		return true
-	}
-	return mh[i].Proc < mh[j].Proc
+	return mh[i].before(mh[j])
 }
 
 func (mh MessageHeap) Swap(i, j int) {
@@ -44,3 +70,9 @@ func (mh *MessageHeap) Pop() interface{} {
 	*mh = prev[0 : n-1]
 	return m
 }
+
+// Push m onto the heap, as with heap.Push but without boxing it
+func (mh *MessageHeap) push(m Message) {
+	*mh = append(*mh, m)
+	heap.Fix(mh, len(*mh)-1)
+}
@@ -0,0 +1,22 @@
+package lamport
+
+import "context"
+
+// Acquire the distributed lock, attaching opaque metadata to the request
+// The metadata (e.g. trace or tenant IDs) travels with the request to all
+// peers, is echoed back on their acknowledgements and carried on the
+// eventual release, and is available from the Guard, so that a critical
+// section can be correlated with the request that triggered it. The map
+// is shared with peers and must not be modified after the call.
+func (state *LamportLockState) AcquireWithMetadata(meta map[string]string) (*Guard, error) {
+	return state.acquire(context.Background(), "", meta, nil)
+}
+
+// Metadata of our own queued request, if any
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) ownMeta() map[string]string {
+	if i, ok := state.ownRequest(); ok {
+		return (*state.reqs)[i].Meta
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package lamport
+
+import (
+	"context"
+	"time"
+)
+
+// Wake the goroutine waiting on our pending request, if it can now proceed:
+// granted, rejected, evicted, unable to progress, or (for AcquireIfIdle)
+// fully acked; or, for AcquireProgress, if its place in the queue has changed
+// Called on every state change (see publish), so that waiters need not poll.
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) notifyWaiter() {
+	if state.held != nil {
+		return
+	}
+	if _, ok := state.ownRequest(); !ok && !state.evct {
+		return
+	}
+	moved := state.prog && state.requestsAhead() != state.posn
+	if !state.evct && !moved && !state.holdsLock() && !state.nckd && !state.degraded() && !(state.idlr && state.allAcked()) {
+		return
+	}
+	select {
+	case state.gsig <- struct{}{}:
+	default:
+	}
+}
+
+// Check whether some live peer is unreachable (see Health)
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) degraded() bool {
+	for p, silent := range state.slnt {
+		if silent && !state.gone[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait until the service loop reports that our pending request can proceed
+// (see notifyWaiter), the ack timeout since sent passes, the lock stops or
+// ctx is done; the caller then re-checks its request
+// Once the ack timeout has passed, the caller has found every peer
+// responsive (peers' times only advance), so only the service loop can
+// report anything new.
+func (state *LamportLockState) awaitProgress(ctx context.Context, sent time.Time) {
+	var timeout <-chan time.Time
+	if d := state.current().ackTimeout; d > 0 {
+		if wait := sent.Add(d).Sub(state.opts.clock.Now()); wait > 0 {
+			timeout = state.opts.clock.After(wait)
+		}
+	}
+	select {
+	case <-state.gsig:
+	case <-timeout:
+	case <-state.quit:
+	case <-ctx.Done():
+	}
+}
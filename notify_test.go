@@ -0,0 +1,59 @@
+package lamport
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Once the ack timeout has passed, a waiter sleeps until the service loop
+// has something to report, rather than polling
+func TestAwaitProgressPastTimeout(t *testing.T) {
+	ls := NewLocalCluster(2, WithAckTimeout(time.Millisecond))
+	defer stopAll(ls)
+
+	sent := time.Now().Add(-time.Second)
+	done := make(chan struct{})
+	go func() {
+		ls[0].awaitProgress(context.Background(), sent)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("awaitProgress returned with nothing to report")
+	case <-time.After(100 * time.Millisecond):
+	}
+	ls[0].Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("awaitProgress did not return on Stop")
+	}
+}
+
+// A request queued behind a live holder for longer than the ack timeout is
+// still granted once the holder releases
+func TestGrantPastAckTimeout(t *testing.T) {
+	ls := NewLocalCluster(2, WithAckTimeout(10*time.Millisecond))
+	defer stopAll(ls)
+
+	g := mustAcquire(t, ls[0])
+	res := make(chan error, 1)
+	go func() {
+		g, err := ls[1].Acquire()
+		if err == nil {
+			g.Release()
+		}
+		res <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	g.Release()
+	select {
+	case err := <-res:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter not granted after release")
+	}
+}
@@ -0,0 +1,259 @@
+package lamport
+
+import "time"
+
+// Optional configuration of the distributed lock
+type options struct {
+	ackTimeout time.Duration
+	clock      Clock
+	holders    int
+	longHold   time.Duration
+	onLongHold func(LongHold)
+	partition  time.Duration
+	retry      RetryPolicy
+	keepalive  time.Duration
+	heartbeat  time.Duration
+	secret     []byte
+	onEvict    func(Eviction)
+	audit      []AuditSink
+	rate       float64
+	burst      int
+	peerRate   float64
+	peerBurst  int
+	ackBatch   time.Duration
+	inbound    []Interceptor
+	outbound   []Interceptor
+	ttl        int
+	store      Store
+	margin     int
+	invariants bool
+	observer   bool
+	detector   func(proc int) FailureDetector
+	trace      int
+}
+
+// Option configures the distributed lock (see Start)
+type Option func(*options)
+
+// Apply the supplied options over the defaults
+func newOptions(opts []Option) options {
+	o := options{clock: realClock{}, holders: 1, trace: TraceLen}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Give up on a request once it has waited longer than d for
+// acknowledgements from peers (zero, the default, waits forever)
+func WithAckTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.ackTimeout = d
+	}
+}
+
+// Use c in place of the system clock for all polling and timeouts
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// Allow up to k processes to hold the lock at once (k-mutual exclusion)
+// All processes must be started with the same k. Each holder still gets
+// its own Guard and fencing token.
+func WithHolders(k int) Option {
+	return func(o *options) {
+		o.holders = k
+	}
+}
+
+// Warn when the local process has held the lock for longer than d, by
+// logging and calling fn (if non-nil) with the stack trace of the
+// goroutine that acquired it, to help catch forgotten releases
+func WithLongHold(d time.Duration, fn func(LongHold)) Option {
+	return func(o *options) {
+		o.longHold = d
+		o.onLongHold = fn
+	}
+}
+
+// Consider a peer unreachable once it has been silent for d while we wait
+// on it, entering degraded mode (see Health) until it is heard from again
+func WithPartitionTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.partition = d
+	}
+}
+
+// Re-request the lock under policy p when Acquire would otherwise fail with
+// a retracted request (ErrNoProgress, ErrPartitioned or ErrStale)
+// Any request following a retraction, including the caller's own retry
+// after a cancellation, first waits out the policy's delay.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// Broadcast a keepalive every d, so that peers waiting on a request need
+// not depend on this process sending messages of its own, and so that
+// silence can be detected while idle (see WithPartitionTimeout)
+func WithKeepalive(d time.Duration) Option {
+	return func(o *options) {
+		o.keepalive = d
+	}
+}
+
+// While holding the lock, broadcast a heartbeat every d, so that peers can
+// tell an active holder from a stuck one (see Holder)
+func WithHeartbeat(d time.Duration) Option {
+	return func(o *options) {
+		o.heartbeat = d
+	}
+}
+
+// Allow administrative evictions (see ForceRelease) authenticated with the
+// shared secret, calling fn (if non-nil) for each one accepted
+// Processes without a secret reject all evictions.
+func WithAdmin(secret []byte, fn func(Eviction)) Option {
+	return func(o *options) {
+		o.secret = secret
+		o.onEvict = fn
+	}
+}
+
+// Limit outgoing lock requests (including retries) to rate per second, in
+// bursts of up to burst, delaying Acquire as needed
+func WithRateLimit(rate float64, burst int) Option {
+	return func(o *options) {
+		o.rate = rate
+		o.burst = burst
+	}
+}
+
+// Limit the requests accepted from each peer to rate per second, in bursts
+// of up to burst, by holding back acknowledgements to peers that exceed it
+// Requests are never dropped, but a peer hot-looping on Acquire is slowed
+// down rather than flooding the service loop.
+func WithPeerRateLimit(rate float64, burst int) Option {
+	return func(o *options) {
+		o.peerRate = rate
+		o.peerBurst = burst
+	}
+}
+
+// Gather acknowledgements for up to d before sending them, so that during a
+// storm of requests the service loop sends acks to many requesters in one
+// pass (e.g. for an outbound interceptor to batch onto the wire)
+// Each request waits up to d longer for our ack. Fixed at startup.
+func WithAckBatching(d time.Duration) Option {
+	return func(o *options) {
+		o.ackBatch = d
+	}
+}
+
+// Pass every message received through the interceptors, in order, before
+// it is processed
+// Interceptors run on the service loop: one that blocks stalls the lock,
+// and one that drops messages may break it (outside of fault injection).
+func WithInbound(ics ...Interceptor) Option {
+	return func(o *options) {
+		o.inbound = append(o.inbound, ics...)
+	}
+}
+
+// Pass every message sent through the interceptors, in order, before it is
+// delivered to the peer's channel
+// Messages pass through one at a time, in the order they were stamped: one
+// that blocks holds up those after it, while passing a message on later,
+// from another goroutine, lets later ones overtake it, which can break
+// mutual exclusion. Interceptors run holding the lock's send lock, so they
+// must not call back into the lock.
+func WithOutbound(ics ...Interceptor) Option {
+	return func(o *options) {
+		o.outbound = append(o.outbound, ics...)
+	}
+}
+
+// Reject peers' requests whose logical time is more than ttl behind our
+// own, e.g. having been stuck in a slow transport, rather than grant them
+// out of any reasonable order
+// The sender is sent a nack, and retracts the request: Acquire fails with
+// ErrStale, or re-requests under the retry policy (see WithRetryPolicy) at a
+// current time. A grant then also requires an ack from every peer. All
+// processes should use the same ttl.
+func WithMessageTTL(ttl int) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// Persist a bound on our logical clock in s, restoring it on startup so that
+// a restarted process never reuses timestamps from before a crash
+// The bound is saved margin ticks ahead (at least one) of the latest
+// timestamp sent, so a larger margin means fewer saves at the cost of a
+// larger jump in the clock on restart. The process's incarnation (see
+// Rejoin) is kept in s too, so that it increases across restarts even if the
+// wall clock steps backwards.
+func WithClockStore(s Store, margin int) Option {
+	return func(o *options) {
+		if margin < 1 {
+			margin = 1
+		}
+		o.store, o.margin = s, margin
+	}
+}
+
+// Check internal invariants after every state change, panicking with a dump
+// of the state on violation (for debugging and integration tests; the checks
+// are linear in the size of the queue)
+func WithInvariants() Option {
+	return func(o *options) {
+		o.invariants = true
+	}
+}
+
+// Keep the last n protocol events in the trace (see Trace), rather than
+// TraceLen; zero (or less) disables tracing
+func WithTrace(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			n = 0
+		}
+		o.trace = n
+	}
+}
+
+// Judge peers' liveness with a failure detector of each process's own,
+// made by calling newDetector with its index on Start (or Rejoin), marking
+// suspected peers unreachable (see Health) in place of the partition
+// timeout (see WithPartitionTimeout)
+// Detectors are never shared, so the option can be passed to a whole
+// cluster (see NewLocalCluster), e.g. as
+//
+//	WithFailureDetector(func(int) FailureDetector { return NewPhiAccrualDetector(8) })
+func WithFailureDetector(newDetector func(proc int) FailureDetector) Option {
+	return func(o *options) {
+		o.detector = newDetector
+	}
+}
+
+// Run the process as an observer, e.g. for monitoring (see Subscribe): it
+// acknowledges its peers' requests like any other process, but never
+// requests the lock itself, so Acquire and its variants fail with
+// ErrObserver
+func WithObserver() Option {
+	return func(o *options) {
+		o.observer = true
+	}
+}
+
+// Record every local acquisition and release, and every eviction seen, to
+// the given sinks (e.g. a FileAuditSink or an AuditFunc)
+// Records are delivered in order; Stop waits for them to be flushed.
+func WithAudit(sinks ...AuditSink) Option {
+	return func(o *options) {
+		o.audit = append(o.audit, sinks...)
+	}
+}
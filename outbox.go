@@ -0,0 +1,57 @@
+package lamport
+
+// Message queued for delivery through the outbound chain (see post)
+type outMsg struct {
+	to    int
+	m     Message
+	lossy bool // dropped rather than blocking if the channel is full
+}
+
+// Queue a message to process to, for delivery by the next flush
+// Messages are stamped and posted under the state lock, so the outbox holds
+// them in timestamp order: sending them directly once the lock is released
+// would let a message stamped later (e.g. an ack from the service loop)
+// overtake one held up in transit (e.g. by a slow outbound interceptor), and
+// a peer seeing the later time would take our earlier request to be absent.
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) post(to int, m Message) {
+	state.outb = append(state.outb, outMsg{to: to, m: m})
+}
+
+// Queue a message to all (non-departed) peers (see post)
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) postAll(m Message) {
+	for _, p := range state.live {
+		state.post(p, m)
+	}
+}
+
+// Queue a message to all (non-departed) peers, to be dropped for any peer
+// whose channel is full (see post)
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) postLossy(m Message) {
+	for _, p := range state.live {
+		state.outb = append(state.outb, outMsg{to: p, m: m, lossy: true})
+	}
+}
+
+// Deliver the queued messages through the outbound chain, in order
+// (threadsafe)
+// Called once the state lock is released by every region that posts. The
+// send lock is held throughout, so that messages taken by a later flush
+// wait for those still being sent.
+func (state *LamportLockState) flush() {
+	state.olck.Lock()
+	defer state.olck.Unlock()
+	state.lock.Lock()
+	ms := state.outb
+	state.outb = nil
+	state.lock.Unlock()
+	for _, o := range ms {
+		if o.lossy {
+			state.xlsy(o.to, o.m)
+		} else {
+			state.xmit(o.to, o.m)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package lamport
+
+import "errors"
+
+// Returned by Acquire while some peers are unreachable (see Health)
+var ErrPartitioned = errors.New("lamport: peers unreachable")
+
+// Snapshot of the local process's view of the group
+type Health struct {
+	Alive    bool  // Service loop is making progress (see Alive)
+	Degraded bool  // Some peers are unreachable, so Acquire cannot succeed
+	Silent   []int // Peers silent past the partition timeout
+}
+
+// Report the health of the local process
+// As every peer must acknowledge a request, a single unreachable peer
+// leaves the process unable to make progress. Without keepalives, silence is
+// only detected while waiting on a request, so each new request re-probes
+// degraded peers.
+func (state *LamportLockState) Health() Health {
+	h := Health{Alive: state.Alive()}
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	for p, silent := range state.slnt {
+		if silent && !state.gone[p] {
+			h.Silent = append(h.Silent, p)
+		}
+	}
+	h.Degraded = len(h.Silent) > 0
+	return h
+}
+
+// Mark peers as silent (cleared when next heard from) that have sent nothing
+// within the partition timeout, either since our pending request or, if
+// keepalives are enabled, at all; or, given a failure detector, that it
+// suspects instead
+// Not threadsafe on its own: called only from serviceMessages (within locked
+// region)
+func (state *LamportLockState) checkPartition() {
+	if fd := state.fdet; fd != nil {
+		now := state.opts.clock.Now()
+		for p := range state.seen {
+			if p != state.proc && !state.gone[p] && fd.Suspected(p, now) {
+				state.slnt[p] = true
+			}
+		}
+		return
+	}
+	timeout := state.opts.partition
+	if timeout <= 0 {
+		return
+	}
+	if state.opts.keepalive > 0 {
+		now := state.opts.clock.Now()
+		for p := range state.hear {
+			if p != state.proc && !state.gone[p] && now.Sub(state.hear[p]) > timeout {
+				state.slnt[p] = true
+			}
+		}
+	}
+	i, ok := state.ownRequest()
+	if !ok || state.opts.clock.Now().Sub(state.rqat) < timeout {
+		return
+	}
+	for p := range state.seen {
+		if p != state.proc && !state.gone[p] && state.seen[p] < (*state.reqs)[i].Time {
+			state.slnt[p] = true
+		}
+	}
+}
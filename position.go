@@ -0,0 +1,63 @@
+package lamport
+
+import (
+	"context"
+	"time"
+)
+
+// Place of a pending request in the queue (see AcquireProgress)
+type Position struct {
+	Ahead int           // Requests queued ahead of ours
+	Wait  time.Duration // Estimated wait: Ahead times the average turn at the head of the queue
+}
+
+// Acquire the distributed lock as with AcquireContext, calling fn with our
+// place in the queue whenever it changes while we wait (e.g. to show "you
+// are 3rd in line")
+// Requests with earlier timestamps may still be in flight from peers, so
+// Ahead is a lower bound; the estimate is based on how long recent requests
+// from any process have stayed at the head of the local queue (zero until
+// one has). fn is called from
+// the acquiring goroutine, and must not block for long.
+func (state *LamportLockState) AcquireProgress(ctx context.Context, fn func(Position)) (*Guard, error) {
+	return state.acquire(ctx, "", nil, fn)
+}
+
+// Report our place in the queue, and whether it has changed since last
+// reported (threadsafe)
+func (state *LamportLockState) position() (Position, bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	ahead := state.requestsAhead()
+	if state.prog && ahead == state.posn {
+		return Position{}, false
+	}
+	state.prog, state.posn = true, ahead
+	return Position{Ahead: ahead, Wait: time.Duration(ahead) * state.turn}, true
+}
+
+// Time each request's turn at the head of the queue, keeping a moving
+// average (weighted 1/8 to the latest, as for TCP round-trip times) so that
+// estimates follow the recent workload
+// Unlike updateHead, this tells successive requests from the same process
+// apart.
+// Not threadsafe on its own: called only from serviceMessages (within locked
+// region)
+func (state *LamportLockState) timeTurn() {
+	var head Message
+	if state.reqs.Len() > 0 {
+		head = (*state.reqs)[0]
+	}
+	if head.Proc == state.hreq.Proc && head.Time == state.hreq.Time {
+		return
+	}
+	now := state.opts.clock.Now()
+	if state.hreq.Time > 0 {
+		if d := now.Sub(state.hrat); state.turn == 0 {
+			state.turn = d
+		} else {
+			state.turn += (d - state.turn) / 8
+		}
+	}
+	state.hreq, state.hrat = head, now
+}
@@ -0,0 +1,71 @@
+package lamport
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Returned (wrapped in a *ProgressError) by Acquire when the ack timeout
+// expires
+var ErrNoProgress = errors.New("lamport: no progress")
+
+// Error describing the peers that failed to acknowledge a request
+type ProgressError struct {
+	Peers []int        // Peers with no message later than the request
+	Trace []TraceEntry // Recent protocol events, oldest first (see Trace)
+}
+
+func (e *ProgressError) Error() string {
+	msg := fmt.Sprintf("%v: no acknowledgement from peers %v", ErrNoProgress, e.Peers)
+	if len(e.Trace) == 0 {
+		return msg
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s; recent events:\n", msg)
+	writeTrace(&b, "  ", e.Trace)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (e *ProgressError) Unwrap() error {
+	return ErrNoProgress
+}
+
+// List the (non-departed) peers that have not advanced past time (threadsafe)
+func (state *LamportLockState) unresponsivePeers(time int) []int {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	var peers []int
+	for p := range state.seen {
+		if p != state.proc && !state.gone[p] && state.seen[p] < time {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// Withdraw our pending request, locally and from all peers (threadsafe)
+func (state *LamportLockState) retractRequest() {
+	// lock state struct (mutating time and reqs)
+	state.lock.Lock()
+
+	// advance logical time, initialize message, dequeue locally
+	state.time += 1
+	m := Message{
+		Type: MessageRetract,
+		Time: state.time,
+		Proc: state.proc,
+		Meta: state.ownMeta()}
+	state.abandonAcks(true)
+	state.removeRequests(state.proc)
+	state.rtrn += 1
+	state.rtat = state.opts.clock.Now()
+	state.publish()
+	state.postAll(m)
+
+	// release
+	state.lock.Unlock()
+
+	// send retract message
+	state.flush()
+}
@@ -0,0 +1,45 @@
+package lamport
+
+// Distributed FIFO queue shared by the processes of a lock
+// The queue contents are a GuardedValue, so Enqueue and Dequeue are
+// totally ordered by the lock, and the same restrictions apply (exclusive
+// grants, one guarded value per lock).
+type Queue[T any] struct {
+	v *GuardedValue[[]T]
+}
+
+// Create a distributed queue protected by the given lock
+func NewQueue[T any](state *LamportLockState) *Queue[T] {
+	return &Queue[T]{v: NewGuardedValue[[]T](state)}
+}
+
+// Append x to the tail of the queue
+func (q *Queue[T]) Enqueue(x T) error {
+	return q.v.Update(func(items []T) []T {
+		// copy, as the previous slice is shared with peers
+		next := make([]T, len(items), len(items)+1)
+		copy(next, items)
+		return append(next, x)
+	})
+}
+
+// Remove and return the head of the queue
+// Returns false if the queue is empty.
+func (q *Queue[T]) Dequeue() (T, bool, error) {
+	var head T
+	found := false
+	err := q.v.Update(func(items []T) []T {
+		if len(items) == 0 {
+			return items
+		}
+		head, found = items[0], true
+		return items[1:]
+	})
+	return head, found, err
+}
+
+// Number of items currently queued
+func (q *Queue[T]) Len() (int, error) {
+	items, err := q.v.Get()
+	return len(items), err
+}
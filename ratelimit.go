@@ -0,0 +1,150 @@
+package lamport
+
+import (
+	"context"
+	"time"
+)
+
+// Token bucket limiting events to rate per second, in bursts of up to burst
+// Events may reserve tokens ahead of time, so that waiters are served in
+// order.
+type bucket struct {
+	rate float64
+	size float64
+	tokn float64
+	last time.Time
+}
+
+// Create a bucket, initially full (a rate of zero is unlimited)
+func newBucket(rate float64, burst int) bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return bucket{rate: rate, size: float64(burst), tokn: float64(burst)}
+}
+
+// Change the rate and burst, keeping the tokens accumulated so far (up to
+// the new burst)
+func (b *bucket) retune(rate float64, burst int) {
+	n := newBucket(rate, burst)
+	b.rate, b.size = n.rate, n.size
+	if b.tokn > b.size {
+		b.tokn = b.size
+	}
+}
+
+// Reserve a token, returning how long to wait before using it
+func (b *bucket) take(now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	if !b.last.IsZero() {
+		b.tokn += now.Sub(b.last).Seconds() * b.rate
+		if b.tokn > b.size {
+			b.tokn = b.size
+		}
+	}
+	b.last = now
+	b.tokn -= 1
+	if b.tokn >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokn / b.rate * float64(time.Second))
+}
+
+// Return a reserved token that will not be used after all
+func (b *bucket) give() {
+	if b.rate <= 0 {
+		return
+	}
+	if b.tokn += 1; b.tokn > b.size {
+		b.tokn = b.size
+	}
+}
+
+// Acknowledgement held back by the per-peer rate limit or batching window
+// (see WithAckBatching)
+type pendingAck struct {
+	at   time.Time // when to send it
+	proc int
+	meta map[string]string
+}
+
+// Wait out the outgoing request rate limit, if any, giving up (and
+// returning the reserved token) if the lock stops or ctx is done
+// (threadsafe)
+func (state *LamportLockState) awaitRateLimit(ctx context.Context) error {
+	// lock state struct (mutating the bucket)
+	state.lock.Lock()
+	if state.stop {
+		state.lock.Unlock()
+		return ErrStopped
+	}
+	wait := state.rlim.take(state.opts.clock.Now())
+	state.lock.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	err := ErrStopped
+	select {
+	case <-state.opts.clock.After(wait):
+		return nil
+	case <-state.quit:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	state.lock.Lock()
+	state.rlim.give()
+	state.lock.Unlock()
+	return err
+}
+
+// Acknowledge a peer's request, holding the ack back if the peer exceeds
+// its rate limit: the request cannot be granted until the peer hears from
+// us again, so a peer flooding requests is slowed without any being dropped
+// With a batching window, every ack is held back for at least the window;
+// either way, acks to each peer stay in request order, as they are due in
+// arrival order and flushed in that order.
+// Not threadsafe on its own: called only from processMessage
+func (state *LamportLockState) ackRequest(m Message) {
+	now := state.opts.clock.Now()
+	wait := state.plim[m.Proc].take(now)
+	if b := state.opts.ackBatch; wait < b {
+		wait = b
+	}
+	if wait <= 0 {
+		state.sendAckMsg(m.Proc, m.Meta)
+		return
+	}
+	state.pack = append(state.pack, pendingAck{at: now.Add(wait), proc: m.Proc, meta: m.Meta})
+}
+
+// Check whether any acks are held back (threadsafe)
+func (state *LamportLockState) acksPending() bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return len(state.pack) > 0
+}
+
+// Send held-back acks that are now due, or drop those to proc if it is
+// non-negative (e.g. it has restarted)
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) flushAcks(proc int) {
+	if len(state.pack) == 0 {
+		return
+	}
+	now := state.opts.clock.Now()
+	kept := state.pack[:0]
+	for _, a := range state.pack {
+		if a.proc == proc {
+			continue
+		}
+		if !a.at.After(now) {
+			state.sendAckMsg(a.proc, a.meta)
+		} else {
+			kept = append(kept, a)
+		}
+	}
+	state.pack = kept
+}
@@ -0,0 +1,47 @@
+package lamport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// A wait for the request rate limit ends when the context is done, or when
+// the lock is stopped
+func TestRateLimitInterrupted(t *testing.T) {
+	ls := NewLocalCluster(2, WithRateLimit(0.2, 1))
+	defer stopAll(ls)
+
+	g, err := ls[0].Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := ls[0].AcquireContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AcquireContext returned %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("AcquireContext returned after %v, want about 50ms", d)
+	}
+
+	res := make(chan error, 1)
+	go func() {
+		_, err := ls[0].Acquire()
+		res <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	ls[0].Stop()
+	select {
+	case err := <-res:
+		if !errors.Is(err, ErrStopped) {
+			t.Errorf("Acquire returned %v, want ErrStopped", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Stop did not interrupt the rate limit wait")
+	}
+}
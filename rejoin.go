@@ -0,0 +1,161 @@
+package lamport
+
+import "container/heap"
+
+// View of the group sent in reply to a joining process (see Rejoin)
+type joinState struct {
+	Gone []bool      // departed processes
+	Reqn []int       // requests seen from each process (see rmvd)
+	Pend *Message    // the replier's own pending request, if any
+	Data interface{} // latest guarded value (see GuardedValue)
+	Dtok int         // fencing token of the grant that shipped Data
+	Open bool        // whether the latch is open (see Latch)
+}
+
+// Restart process p in a running group, after its previous incarnation
+// has stopped (or crashed), as with Start
+// The process announces itself to its peers under a new, later incarnation
+// (see Message and WithClockStore), so that they drop any messages still in
+// flight from its previous one, and purge any requests left from it and
+// reply with their view of the group: membership, their own pending
+// requests and their logical times, along with the latest guarded value and
+// the state of the latch. Acquire
+// blocks until every live peer has replied, so the process never requests
+// the lock at a logical time older than any peer has seen from it.
+func Rejoin(p int, chns []chan Message, opts ...Option) *LamportLockState {
+	// initialize distributed lock state, awaiting every peer
+	state := initState(p, chns, newOptions(opts))
+	for q := range state.wait {
+		state.wait[q] = q != p
+	}
+	state.checkJoined()
+	state.startAudit()
+
+	// spin up progess routine
+	go state.serve()
+
+	// announce ourselves to every peer: we do not yet know which have
+	// departed
+	state.lock.Lock()
+	state.time += 1
+	m := Message{
+		Type: MessageJoin,
+		Time: state.time,
+		Proc: state.proc}
+	for q := range state.chns {
+		if q != state.proc {
+			state.post(q, m)
+		}
+	}
+	state.lock.Unlock()
+	state.flush()
+
+	// return the state struct
+	return state
+}
+
+// Reply to a (re)joining process with our view of the group, after purging
+// any requests left from its previous incarnation
+// Not threadsafe on its own: called only from processMessage
+func (state *LamportLockState) joinPeer(p int) {
+	state.removeRequests(p)
+	state.flushAcks(p)
+	state.gone[p] = false
+	state.updateLive()
+	// a holder needs no ack from the joiner (see allAcked)
+	state.ackd[p] = state.held != nil
+	state.late[p] = 0
+
+	// advance logical time, initialize reply
+	state.time += 1
+	js := joinState{
+		Gone: append([]bool(nil), state.gone...),
+		Reqn: append([]int(nil), state.reqn...),
+		Data: state.data,
+		Dtok: state.dtok}
+	select {
+	case <-state.open:
+		js.Open = true
+	default:
+	}
+	if i, ok := state.ownRequest(); ok {
+		req := (*state.reqs)[i]
+		js.Pend = &req
+	}
+	r := Message{Type: MessageState, Time: state.time, Proc: state.proc, Data: js}
+
+	// the joiner makes no request before processing our reply, so its
+	// requests will all follow it
+	state.seen[p] = state.time
+	state.post(p, r)
+}
+
+// Adopt a peer's view of the group in reply to our join
+// Not threadsafe on its own: called only from processMessage
+func (state *LamportLockState) recvJoinState(m Message) {
+	js, ok := m.Data.(joinState)
+	if !ok || !state.wait[m.Proc] {
+		return
+	}
+	state.wait[m.Proc] = false
+	state.gone[m.Proc] = false
+
+	// take the peer's pending request from its reply, rather than from
+	// any messages it sent to our previous incarnation
+	kept := make([]Message, 0, state.reqs.Len())
+	for _, req := range *state.reqs {
+		if req.Proc != m.Proc {
+			kept = append(kept, req)
+		}
+	}
+	*state.reqs = kept
+	heap.Init(state.reqs)
+	state.qver += 1
+	if js.Pend != nil {
+		state.reqs.push(*js.Pend)
+		state.sendAckMsg(m.Proc, js.Pend.Meta)
+	}
+
+	// stop waiting on peers known to have departed, unless they reply
+	for q, gone := range js.Gone {
+		if gone && q != state.proc && state.wait[q] {
+			state.gone[q] = true
+		}
+	}
+	state.updateLive()
+	for q, n := range js.Reqn {
+		if n > state.reqn[q] {
+			state.reqn[q] = n
+		}
+	}
+
+	// catch up on the guarded value and latch
+	state.recvData(Message{Tokn: js.Dtok, Data: js.Data})
+	if js.Open {
+		state.openLatch()
+	}
+}
+
+// Complete our join once every live peer has replied
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) checkJoined() {
+	select {
+	case <-state.join:
+		return
+	default:
+	}
+	for q, w := range state.wait {
+		if w && !state.gone[q] {
+			return
+		}
+	}
+
+	// every request seen anywhere is either still queued or removed, so
+	// our grants rank after those of our previous incarnation (see grant)
+	n := 0
+	for _, c := range state.reqn {
+		n += c
+	}
+	state.rmvd = n - state.reqs.Len()
+	close(state.join)
+}
@@ -0,0 +1,77 @@
+package lamport
+
+import (
+	"log"
+	"os"
+	"os/signal"
+)
+
+// Snapshot the options, which Reconfigure may change (threadsafe)
+func (state *LamportLockState) current() options {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.opts
+}
+
+// Apply opts to a running process, without dropping a held lock or pending
+// request
+// Only the timeouts, intervals, retry policy and rate limits take effect
+// (see WithAckTimeout, WithLongHold, WithPartitionTimeout, WithRetryPolicy,
+// WithKeepalive, WithHeartbeat, WithRateLimit and WithPeerRateLimit); other
+// options are fixed at startup, and ignored here. New intervals apply from
+// the next periodic check.
+func (state *LamportLockState) Reconfigure(opts ...Option) {
+	// lock state struct (mutating opts and limits)
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	o := state.opts
+	for _, opt := range opts {
+		opt(&o)
+	}
+	state.opts.ackTimeout = o.ackTimeout
+	state.opts.longHold, state.opts.onLongHold = o.longHold, o.onLongHold
+	state.opts.partition = o.partition
+	state.opts.retry = o.retry
+	state.opts.keepalive = o.keepalive
+	state.opts.heartbeat = o.heartbeat
+	if o.rate != state.opts.rate || o.burst != state.opts.burst {
+		state.rlim.retune(o.rate, o.burst)
+		state.opts.rate, state.opts.burst = o.rate, o.burst
+	}
+	if o.peerRate != state.opts.peerRate || o.peerBurst != state.opts.peerBurst {
+		for p := range state.plim {
+			state.plim[p].retune(o.peerRate, o.peerBurst)
+		}
+		state.opts.peerRate, state.opts.peerBurst = o.peerRate, o.peerBurst
+	}
+}
+
+// Reconfigure the process with the options returned by load on each of the
+// given signals (e.g. syscall.SIGHUP), until the returned function is called
+// If load fails, the error is logged and the configuration left unchanged.
+func (state *LamportLockState) ReconfigureOn(load func() ([]Option, error), sigs ...os.Signal) func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-c:
+				opts, err := load()
+				if err != nil {
+					log.Printf("lamport: process %d failed to reload configuration: %v",
+						state.proc, err)
+					continue
+				}
+				state.Reconfigure(opts...)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
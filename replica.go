@@ -0,0 +1,56 @@
+package lamport
+
+import "sync"
+
+// Deterministic state machine replicated across the processes of a lock
+// Commands are appended to a log kept in a GuardedValue (so the same
+// restrictions apply), giving every replica the same total order in which
+// to apply them. The log is never truncated.
+type Replica[C any] struct {
+	log   *GuardedValue[[]C]
+	apply func(C)
+	lock  sync.Mutex
+	next  int // index of next log entry to apply
+}
+
+// Create a replica applying commands via apply, protected by the given lock
+// apply must be deterministic, and is never called concurrently.
+func NewReplica[C any](state *LamportLockState, apply func(C)) *Replica[C] {
+	return &Replica[C]{log: NewGuardedValue[[]C](state), apply: apply}
+}
+
+// Apply any entries of log not yet applied locally
+func (r *Replica[C]) catchUp(log []C) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for ; r.next < len(log); r.next++ {
+		r.apply(log[r.next])
+	}
+}
+
+// Append cmd to the log, then apply all entries up to and including it
+func (r *Replica[C]) Submit(cmd C) error {
+	var log []C
+	err := r.log.Update(func(cur []C) []C {
+		// copy, as the previous slice is shared with peers
+		log = make([]C, len(cur), len(cur)+1)
+		copy(log, cur)
+		log = append(log, cmd)
+		return log
+	})
+	if err != nil {
+		return err
+	}
+	r.catchUp(log)
+	return nil
+}
+
+// Apply all entries submitted anywhere in the cluster so far
+func (r *Replica[C]) Sync() error {
+	log, err := r.log.Get()
+	if err != nil {
+		return err
+	}
+	r.catchUp(log)
+	return nil
+}
@@ -0,0 +1,84 @@
+package lamport
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Policy deciding whether, and after what delay, to retry an operation
+type RetryPolicy interface {
+	// Delay before retry number attempt (starting at 1), or false to give up
+	Next(attempt int) (time.Duration, bool)
+}
+
+// Exponential backoff with jitter
+type ExponentialBackoff struct {
+	Initial    time.Duration // Delay before the first retry
+	Max        time.Duration // Cap on the delay (zero for no cap)
+	Multiplier float64       // Growth factor per attempt
+	Jitter     float64       // Fraction of each delay that is randomized
+	Attempts   int           // Maximum number of retries (zero for no limit)
+}
+
+// Default retry policy: exponential backoff with jitter, from 10 SleepTime
+// intervals doubling up to 100x that, with no limit on attempts
+func DefaultRetryPolicy() *ExponentialBackoff {
+	return &ExponentialBackoff{
+		Initial:    10 * SleepTime,
+		Max:        1000 * SleepTime,
+		Multiplier: 2,
+		Jitter:     0.5}
+}
+
+func (b *ExponentialBackoff) Next(attempt int) (time.Duration, bool) {
+	if b.Attempts > 0 && attempt > b.Attempts {
+		return 0, false
+	}
+	d := float64(b.Initial)
+	for i := 1; i < attempt && (b.Max <= 0 || d < float64(b.Max)); i++ {
+		d *= b.Multiplier
+	}
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	// spread retries over [d*(1-Jitter), d] so that peers desynchronize
+	d -= d * b.Jitter * rand.Float64()
+	return time.Duration(d), true
+}
+
+// Wait out the retry policy's delay (if any) after a retracted request,
+// whether the retry is ours (see WithRetryPolicy) or the caller's, e.g.
+// after a cancelled AcquireContext (threadsafe)
+// The delay grows with each consecutive retraction, and resets on a grant,
+// so that processes retrying in a herd desynchronize.
+func (state *LamportLockState) awaitBackoff(ctx context.Context) error {
+	state.lock.Lock()
+	var wait time.Duration
+	if retry := state.opts.retry; retry != nil && state.rtrn > 0 {
+		if delay, ok := retry.Next(state.rtrn); ok {
+			wait = state.rtat.Add(delay).Sub(state.opts.clock.Now())
+		}
+	}
+	state.lock.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-state.opts.clock.After(wait):
+		return nil
+	case <-state.quit:
+		return ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Check whether err came from a request that was retracted, and so may be
+// retried
+func retryable(err error) bool {
+	return errors.Is(err, ErrNoProgress) || errors.Is(err, ErrPartitioned) ||
+		errors.Is(err, ErrStale)
+}
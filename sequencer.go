@@ -0,0 +1,62 @@
+package lamport
+
+// Cluster-wide source of gap-free sequence numbers, e.g. for ordering log
+// entries or as idempotency keys
+// Numbers are handed out in grant order, so they follow fencing tokens. The
+// last number issued is a GuardedValue, so the same restrictions apply
+// (exclusive grants, one guarded value per lock: a Sequencer cannot share
+// its lock with a Counter).
+type Sequencer struct {
+	v *GuardedValue[int64]
+}
+
+// Create a sequencer protected by the given lock
+func NewSequencer(state *LamportLockState) *Sequencer {
+	return &Sequencer{v: NewGuardedValue[int64](state)}
+}
+
+// Issue the next sequence number (starting from 1)
+func (s *Sequencer) Next() (int64, error) {
+	return s.Reserve(1)
+}
+
+// Issue a block of n (at least one) consecutive sequence numbers, returning
+// the first
+func (s *Sequencer) Reserve(n int64) (int64, error) {
+	if n < 1 {
+		n = 1
+	}
+	var first int64
+	err := s.v.Update(func(cur int64) int64 {
+		first = cur + 1
+		return cur + n
+	})
+	return first, err
+}
+
+// Issue the next sequence number to fn, which runs under the lock (so no
+// other number is issued until it returns), returning the number
+// If fn fails, the number is not consumed, and its error is returned: the
+// next caller is issued the same number, so that side effects recorded by
+// fn (e.g. log appends) stay gap-free. Likewise if fn panics, after the
+// lock is released. Should the lock be lost while fn runs (e.g. evicted),
+// ErrNotHeld is returned and the number is not consumed either, so it will
+// be reissued even though fn has used it.
+func (s *Sequencer) Sequence(fn func(seq int64) error) (int64, error) {
+	g, err := s.v.state.Acquire()
+	if err != nil {
+		return 0, err
+	}
+	var seq int64
+	err = runLocked(g, func() error {
+		seq = s.v.load() + 1
+		if err := fn(seq); err != nil {
+			return err
+		}
+		return s.v.store(g, seq)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
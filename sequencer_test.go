@@ -0,0 +1,50 @@
+package lamport
+
+import (
+	"errors"
+	"testing"
+)
+
+// A number issued to a sequence function is only consumed if the function
+// succeeds under a grant that is still held
+func TestSequenceNotConsumed(t *testing.T) {
+	ls := NewLocalCluster(2, WithAdmin([]byte("secret"), nil))
+	defer stopAll(ls)
+	ss := []*Sequencer{NewSequencer(ls[0]), NewSequencer(ls[1])}
+
+	if seq, err := ss[0].Next(); err != nil || seq != 1 {
+		t.Fatalf("Next() = %d, %v; want 1, nil", seq, err)
+	}
+
+	// failed, panicking and evicted sequence functions all leave 2 unused
+	fail := errors.New("fail")
+	if _, err := ss[0].Sequence(func(int64) error { return fail }); err != fail {
+		t.Errorf("failed Sequence returned %v, want %v", err, fail)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic in Sequence was not propagated")
+			}
+		}()
+		ss[0].Sequence(func(int64) error { panic("boom") })
+	}()
+	_, err := ss[0].Sequence(func(int64) error {
+		ls[1].ForceRelease(0)
+		waitFor(t, func() bool { return !ls[0].haveLock() })
+		return nil
+	})
+	if !errors.Is(err, ErrNotHeld) {
+		t.Errorf("evicted Sequence returned %v, want ErrNotHeld", err)
+	}
+
+	// let process 0 release once more, so that its latest value is shipped
+	g, err := ls[0].Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Release()
+	if seq, err := ss[1].Next(); err != nil || seq != 2 {
+		t.Errorf("Next() = %d, %v; want 2, nil", seq, err)
+	}
+}
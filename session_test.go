@@ -0,0 +1,95 @@
+package lamport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Acquire the lock in the named session, failing the test if it is not
+// granted within a few seconds
+func mustAcquireSession(t *testing.T, l *LamportLockState, session string) *Guard {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	g, err := l.acquire(ctx, session, nil, nil)
+	if err != nil {
+		t.Fatalf("process %d: acquire of session %q failed: %v", l.proc, session, err)
+	}
+	return g
+}
+
+// Processes in the same session hold the lock together, while different
+// sessions take turns in request order
+func TestSessions(t *testing.T) {
+	ls := NewLocalCluster(3)
+	defer stopAll(ls)
+
+	// the same session is shared
+	g0 := mustAcquireSession(t, ls[0], "a")
+	mustAcquireSession(t, ls[1], "a").Release()
+
+	// a different session waits, and a later request in the held session
+	// waits behind it rather than joining the holder
+	got := make(chan *Guard, 2)
+	go func() {
+		g, _ := ls[2].AcquireSession("b")
+		got <- g
+	}()
+	waitFor(t, func() bool { return ls[1].queued(2) })
+	go func() {
+		g, _ := ls[1].AcquireSession("a")
+		got <- g
+	}()
+	waitFor(t, func() bool { return ls[2].queued(1) })
+	select {
+	case g := <-got:
+		t.Fatalf("process %d granted lock while session %q held", g.state.proc, "a")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// each is granted in turn
+	next := func(want int) *Guard {
+		t.Helper()
+		select {
+		case g := <-got:
+			if g.state.proc != want {
+				t.Fatalf("process %d granted lock out of request order, want %d", g.state.proc, want)
+			}
+			return g
+		case <-time.After(5 * time.Second):
+			t.Fatalf("process %d not granted lock in turn", want)
+		}
+		return nil
+	}
+	g0.Release()
+	next(2).Release()
+	next(1).Release()
+
+	// under contention, different sessions never hold the lock at once
+	var lock sync.Mutex
+	inside, session := 0, ""
+	var wg sync.WaitGroup
+	for p, l := range ls {
+		wg.Add(1)
+		go func(l *LamportLockState, mine string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				g := mustAcquireSession(t, l, mine)
+				lock.Lock()
+				if inside > 0 && session != mine {
+					t.Errorf("session %q granted while %q held", mine, session)
+				}
+				inside, session = inside+1, mine
+				lock.Unlock()
+				time.Sleep(50 * time.Microsecond)
+				lock.Lock()
+				inside -= 1
+				lock.Unlock()
+				g.Release()
+			}
+		}(l, []string{"a", "b"}[p%2])
+	}
+	wg.Wait()
+}
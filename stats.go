@@ -0,0 +1,199 @@
+package lamport
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Histogram sub-buckets per power of two (values are recorded to within
+// 1/histSub of their magnitude, HDR-style)
+const histSub = 8
+
+// Histogram of durations with logarithmic buckets
+type histogram struct {
+	counts [64 * histSub]int64
+	n      int64
+	max    time.Duration
+}
+
+// Bucket index for v: exact below histSub, then histSub buckets for each
+// subsequent power of two
+func histBucket(v int64) int {
+	if v < histSub {
+		return int(v)
+	}
+	e := bits.Len64(uint64(v)) - 4 // v>>e in [histSub, 2*histSub)
+	return (e+1)*histSub + int(v>>e) - histSub
+}
+
+// Largest value recorded in bucket i
+func histUpper(i int) int64 {
+	if i < histSub {
+		return int64(i)
+	}
+	e := i/histSub - 1
+	m := int64(i%histSub + histSub)
+	return (m+1)<<e - 1
+}
+
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[histBucket(int64(d))] += 1
+	h.n += 1
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Upper bound on the q-th quantile (0 < q <= 1) of recorded values
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	target := int64(q*float64(h.n) + 0.5)
+	if target < 1 {
+		target = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			if d := time.Duration(histUpper(i)); d < h.max {
+				return d
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) percentiles() Percentiles {
+	return Percentiles{
+		P50: h.quantile(0.50),
+		P95: h.quantile(0.95),
+		P99: h.quantile(0.99),
+		Max: h.max}
+}
+
+// Latency distributions recorded by a LamportLockState
+type stats struct {
+	lock sync.Mutex
+	wait histogram // Acquire call to grant
+	hold histogram // grant to release (or loss)
+	peer []peerStats
+}
+
+// Acknowledgement timings for a single peer
+type peerStats struct {
+	rtt  histogram // request sent to ack received
+	miss int64     // requests retracted before the peer acked
+}
+
+func (s *stats) acquired(d time.Duration) {
+	s.lock.Lock()
+	s.wait.record(d)
+	s.lock.Unlock()
+}
+
+func (s *stats) released(d time.Duration) {
+	s.lock.Lock()
+	s.hold.record(d)
+	s.lock.Unlock()
+}
+
+// Summary of a latency distribution
+// Percentiles are upper bounds, accurate to within 1/8 of their value.
+type Percentiles struct {
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// Acknowledgement statistics for a single peer
+type PeerStats struct {
+	Proc   int         // Peer process
+	Acks   int64       // Acknowledgements received
+	Missed int64       // Requests retracted before the peer acknowledged
+	RTT    Percentiles // Time from sending a request to receiving its ack
+}
+
+// Snapshot of lock statistics for the local process
+type Stats struct {
+	Acquires       int64       // Successful Acquire calls
+	AcquireLatency Percentiles // Time from Acquire call to grant
+	HoldDuration   Percentiles // Time from grant to release (or loss)
+	Peers          []PeerStats // Per-peer acknowledgements (excluding self)
+}
+
+// Report lock statistics for the local process
+func (state *LamportLockState) Stats() Stats {
+	s := &state.stat
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	peers := make([]PeerStats, 0, len(s.peer))
+	for p := range s.peer {
+		if p != state.proc {
+			peers = append(peers, PeerStats{
+				Proc:   p,
+				Acks:   s.peer[p].rtt.n,
+				Missed: s.peer[p].miss,
+				RTT:    s.peer[p].rtt.percentiles()})
+		}
+	}
+	return Stats{
+		Acquires:       s.wait.n,
+		AcquireLatency: s.wait.percentiles(),
+		HoldDuration:   s.hold.percentiles(),
+		Peers:          peers}
+}
+
+// Start timing acknowledgements for a new request
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) requestSent() {
+	state.rqat = state.opts.clock.Now()
+	for p := range state.ackd {
+		state.ackd[p] = p == state.proc
+		state.slnt[p] = false
+	}
+}
+
+// Record an acknowledgement from peer p
+// Acks from a peer arrive in request order, so any still due for retracted
+// requests come first and are discarded.
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) ackReceived(p int) {
+	if state.late[p] > 0 {
+		state.late[p] -= 1
+		return
+	}
+	if _, ok := state.ownRequest(); !ok || state.ackd[p] {
+		return
+	}
+	state.ackd[p] = true
+	s := &state.stat
+	s.lock.Lock()
+	s.peer[p].rtt.record(state.opts.clock.Now().Sub(state.rqat))
+	s.lock.Unlock()
+}
+
+// Stop waiting on acks for our request as it is removed, counting them as
+// missed if it is being retracted (rather than released or transferred)
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) abandonAcks(missed bool) {
+	s := &state.stat
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for p, ok := range state.ackd {
+		if !ok && !state.gone[p] {
+			state.ackd[p] = true
+			state.late[p] += 1
+			if missed {
+				s.peer[p].miss += 1
+			}
+		}
+	}
+}
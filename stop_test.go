@@ -0,0 +1,75 @@
+package lamport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Stop waits for the holder to release the lock before departing, while
+// peers wait on it
+func TestStopWaitsForRelease(t *testing.T) {
+	ls := NewLocalCluster(2)
+	defer stopAll(ls)
+
+	g := mustAcquire(t, ls[0])
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- ls[0].StopContext(ctx)
+	}()
+	waitFor(t, ls[0].stopped)
+	if _, err := ls[0].Acquire(); !errors.Is(err, ErrStopped) {
+		t.Errorf("Acquire while stopping returned %v, want ErrStopped", err)
+	}
+
+	got := make(chan *Guard, 1)
+	go func() {
+		g, _ := ls[1].Acquire()
+		got <- g
+	}()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop returned (%v) while the lock was held", err)
+	case <-got:
+		t.Fatal("peer granted lock while the holder was still in its critical section")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := g.Release(); err != nil {
+		t.Fatalf("release while stopping returned %v", err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Stop returned %v after the release", err)
+	}
+	if g1 := <-got; g1 == nil {
+		t.Error("peer not granted lock once Stop completed")
+	} else {
+		g1.Release()
+	}
+}
+
+// Stop releases the lock regardless once its deadline passes, leaving the
+// holder's release a no-op
+func TestStopForcesRelease(t *testing.T) {
+	ls := NewLocalCluster(2)
+	defer stopAll(ls)
+
+	g := mustAcquire(t, ls[0])
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ls[0].StopContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop returned %v, want context.DeadlineExceeded", err)
+	}
+	select {
+	case <-g.Done():
+	default:
+		t.Error("guard still held after Stop")
+	}
+	if err := g.Release(); err != nil {
+		t.Errorf("release after Stop returned %v, want a no-op", err)
+	}
+	mustAcquire(t, ls[1]).Release()
+}
@@ -0,0 +1,91 @@
+package lamport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returned by FileStore for keys that cannot name a file
+var ErrBadKey = errors.New("lamport: invalid store key")
+
+// Durable key-value storage for state that must survive restarts (e.g. the
+// logical clock)
+// Save must be atomic: after a crash, Load returns either the old or the new
+// data in full. Embedders can plug in their own storage (e.g. SQLite) by
+// implementing the interface.
+type Store interface {
+	// Return the data last saved under key, or nil if there is none
+	Load(key string) ([]byte, error)
+	// Durably replace the data saved under key
+	Save(key string, data []byte) error
+}
+
+// Store keeping each key in its own file in a directory
+type FileStore struct {
+	dir string
+}
+
+// Use the directory dir (created if needed) for storage
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Map key to its file, rejecting keys that would escape the directory
+func (s *FileStore) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", ErrBadKey
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+// Return the contents of key's file, or nil if it does not exist
+func (s *FileStore) Load(key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Write data to a temporary file, sync it, and rename it over key's file
+func (s *FileStore) Save(key string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, key+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return err
+	}
+	// sync the directory, so that the rename itself is durable
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,118 @@
+package lamport
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Default number of protocol events kept per lock (see WithTrace)
+const TraceLen = 64
+
+// Names of message types, as traced
+var messageNames = [messageTypes]string{
+	MessageRequest:   "request",
+	MessageRelease:   "release",
+	MessageAck:       "ack",
+	MessageDepart:    "depart",
+	MessageTransfer:  "transfer",
+	MessageRetract:   "retract",
+	MessageOpen:      "open",
+	MessageKeepalive: "keepalive",
+	MessageHeartbeat: "heartbeat",
+	MessageEvict:     "evict",
+	MessageJoin:      "join",
+	MessageState:     "state",
+	MessageNack:      "nack",
+}
+
+// Protocol event recorded in the trace (see Trace)
+type TraceEntry struct {
+	At    time.Time // Wall clock time of the event
+	Time  int       // Our logical time at the event
+	Event string    // "sent", "received", or a local event (e.g. "granted token 3")
+	Type  int       // Message type (sent and received only)
+	Peer  int       // Destination or origin (sent and received only)
+	Stamp int       // Logical time of the message (sent and received only)
+}
+
+func (e TraceEntry) String() string {
+	at := e.At.Format("15:04:05.000000")
+	switch e.Event {
+	case "sent":
+		return fmt.Sprintf("%s t=%d sent %s to %d", at, e.Time, messageNames[e.Type], e.Peer)
+	case "received":
+		return fmt.Sprintf("%s t=%d received %s from %d at %d",
+			at, e.Time, messageNames[e.Type], e.Peer, e.Stamp)
+	}
+	return fmt.Sprintf("%s t=%d %s", at, e.Time, e.Event)
+}
+
+// Recent protocol events, oldest first (threadsafe)
+// Messages sent and received (other than keepalives and heartbeats) are
+// recorded along with grants and their end, so that a failed acquisition can
+// be diagnosed after the fact; the trace is also included in debug dumps and
+// in a *ProgressError.
+func (state *LamportLockState) Trace() []TraceEntry {
+	state.tlck.Lock()
+	defer state.tlck.Unlock()
+	if state.tful {
+		return append(append([]TraceEntry(nil), state.trce[state.tpos:]...), state.trce[:state.tpos]...)
+	}
+	return append([]TraceEntry(nil), state.trce[:state.tpos]...)
+}
+
+// Record an event in the trace ring, overwriting the oldest once full
+// (threadsafe, as messages are sent outside locked regions)
+func (state *LamportLockState) traceEvent(e TraceEntry) {
+	if len(state.trce) == 0 {
+		return
+	}
+	e.At = state.opts.clock.Now()
+	state.tlck.Lock()
+	state.trce[state.tpos] = e
+	if state.tpos += 1; state.tpos == len(state.trce) {
+		state.tpos, state.tful = 0, true
+	}
+	state.tlck.Unlock()
+}
+
+// Check whether a message is worth tracing: periodic liveness messages
+// would soon crowd everything else out of the ring
+func traced(m Message) bool {
+	return m.Type != MessageKeepalive && m.Type != MessageHeartbeat
+}
+
+// Interceptor tracing messages as they are sent
+func (state *LamportLockState) traceSent(next Handler) Handler {
+	return func(to int, m Message) {
+		if traced(m) {
+			state.traceEvent(TraceEntry{Time: m.Time, Event: "sent", Type: m.Type, Peer: to, Stamp: m.Time})
+		}
+		next(to, m)
+	}
+}
+
+// Trace a message about to be processed
+// Not threadsafe on its own: called only from serviceMessages (within locked
+// region)
+func (state *LamportLockState) traceReceived(m Message) {
+	if traced(m) {
+		state.traceEvent(TraceEntry{Time: state.time, Event: "received", Type: m.Type, Peer: m.Proc, Stamp: m.Time})
+	}
+}
+
+// Trace a local event, such as a grant
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) traceLocal(format string, args ...interface{}) {
+	if len(state.trce) > 0 {
+		state.traceEvent(TraceEntry{Time: state.time, Event: fmt.Sprintf(format, args...)})
+	}
+}
+
+// Write the trace to w, one event per line, each with the given indent
+func writeTrace(w io.Writer, indent string, trace []TraceEntry) {
+	for _, e := range trace {
+		fmt.Fprintf(w, "%s%v\n", indent, e)
+	}
+}
@@ -0,0 +1,110 @@
+package lamport
+
+import (
+	"container/heap"
+	"errors"
+)
+
+// Errors returned by Guard.TransferTo
+var (
+	ErrNotHeld   = errors.New("lamport: lock not held")
+	ErrNoRequest = errors.New("lamport: target has no pending request")
+)
+
+// Hand the held lock from proc to the process making request req, by
+// replacing proc's request with req (re-stamped with the time of proc's
+// request, so that it takes its place at the head of the queue); all other
+// requests keep their order
+// The transfer may reach us ahead of req itself, on another link: req is
+// then queued from the transfer, and the original dropped once it arrives
+// (see processMessage), so that we do not take the lock alongside the
+// target. If we are the target, our grant follows on from the holder's
+// token.
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) transferRequest(proc int, req Message, token int) {
+	// find the time of the current holder's request
+	t := -1
+	for _, r := range *state.reqs {
+		if r.Proc == proc {
+			t = r.Time
+		}
+	}
+	state.removeRequests(proc)
+	if t < 0 {
+		return
+	}
+
+	// re-stamp the target's request, queueing it if it has yet to arrive
+	// (those the target sent since req would have followed it), and restore
+	// heap order
+	dest, found := req.Proc, false
+	for i, r := range *state.reqs {
+		if r.Proc == dest {
+			(*state.reqs)[i].Time = t
+			found = true
+		}
+	}
+	if !found && state.seen[dest] < req.Time {
+		state.xfrd[dest] = req.Time
+		req.Time = t
+		state.reqs.push(req)
+		state.reqn[dest] += 1
+	}
+	heap.Init(state.reqs)
+	state.qver += 1
+
+	// re-stamping reorders our request, so rank it directly after the
+	// holder's rather than by what now precedes it (see grant)
+	if dest == state.proc {
+		state.prio = token - state.requestsAhead()
+	}
+}
+
+// Transfer the held lock directly to proc, bypassing queue order (threadsafe)
+func (state *LamportLockState) transferTo(proc, token int) error {
+	// lock state struct (mutating time and reqs)
+	state.lock.Lock()
+
+	// check that we hold the lock and that the target is waiting for it
+	if state.stop {
+		state.lock.Unlock()
+		return ErrStopped
+	}
+	if !state.holdsLock() {
+		state.lock.Unlock()
+		return ErrNotHeld
+	}
+	var req Message
+	found := false
+	for _, r := range *state.reqs {
+		if r.Proc == proc {
+			req, found = r, true
+		}
+	}
+	if !found || proc == state.proc {
+		state.lock.Unlock()
+		return ErrNoRequest
+	}
+
+	// advance logical time, initialize message, transfer locally
+	state.time += 1
+	m := Message{
+		Type: MessageTransfer,
+		Time: state.time,
+		Proc: state.proc,
+		Dest: proc,
+		Rqst: &req}
+	state.shipData(&m)
+	state.abandonAcks(false)
+	state.transferRequest(state.proc, req, token)
+	state.dropGuard(AuditTransfer)
+	state.publish()
+	state.postAll(m)
+
+	// release
+	state.lock.Unlock()
+
+	// send transfer message
+	state.flush()
+	return nil
+}
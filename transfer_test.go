@@ -0,0 +1,75 @@
+package lamport
+
+import (
+	"testing"
+)
+
+// Check whether proc has a request in our queue (threadsafe)
+func (state *LamportLockState) queued(proc int) bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	for _, req := range *state.reqs {
+		if req.Proc == proc {
+			return true
+		}
+	}
+	return false
+}
+
+// A transfer overtaking the target's request to a third process hands the
+// lock to the target alone: the third process queues the request carried
+// by the transfer, and drops the original once it arrives
+func TestTransferOvertakesRequest(t *testing.T) {
+	chns := localChannels(3)
+	w := &withholder{to: 2}
+	ls := []*LamportLockState{
+		Start(0, chns, WithInvariants()),
+		Start(1, chns, WithInvariants(), WithOutbound(w.intercept)),
+		Start(2, chns, WithInvariants()),
+	}
+	defer stopAll(ls)
+
+	// 0 holds the lock, 2 waits for it
+	g := mustAcquire(t, ls[0])
+	got := make(chan *Guard, 2)
+	go func() {
+		g, _ := ls[2].Acquire()
+		got <- g
+	}()
+	waitFor(t, func() bool { return ls[0].queued(2) && ls[1].queued(2) })
+
+	// 1 requests, its request held up on the way to 2
+	w.lock.Lock()
+	w.hold = true
+	w.lock.Unlock()
+	go func() {
+		g, _ := ls[1].Acquire()
+		got <- g
+	}()
+	waitFor(t, func() bool { return ls[0].queued(1) })
+
+	// the transfer reaches 2 before 1's request does
+	if err := g.TransferTo(1); err != nil {
+		t.Fatal(err)
+	}
+	g1 := <-got
+	if g1 == nil || g1.state != ls[1] {
+		t.Fatal("transfer not granted to its target")
+	}
+	waitFor(t, func() bool { return !ls[2].queued(0) })
+	if !ls[2].queued(1) || ls[2].haveLock() {
+		t.Fatal("lock granted to bystander alongside transfer target")
+	}
+
+	// the original request arrives late, and is not queued again
+	w.release()
+	g1.Release()
+	g2 := <-got
+	if g2 == nil || g2.state != ls[2] {
+		t.Fatal("bystander not granted lock after target released it")
+	}
+	if n := ls[2].queueLen(); n != 1 {
+		t.Errorf("bystander queue has %d requests, want only its own", n)
+	}
+	g2.Release()
+}
@@ -0,0 +1,75 @@
+package lamport
+
+import "errors"
+
+// Returned by Acquire when a peer rejects our request as stale (see
+// WithMessageTTL)
+var ErrStale = errors.New("lamport: request rejected as stale")
+
+// Check whether a peer's request is too old, by logical time, to be queued
+// Not threadsafe on its own: called only from processMessage
+func (state *LamportLockState) staleRequest(m Message) bool {
+	return state.opts.ttl > 0 && m.Time+state.opts.ttl < state.time
+}
+
+// Reject a stale request, telling its sender to retract it
+// The sender's peers will count the request as removed once it is
+// retracted, so we count it likewise to keep fencing tokens in step (see
+// removeRequests).
+// Not threadsafe on its own: called only from processMessage
+func (state *LamportLockState) rejectRequest(m Message) {
+	state.reqn[m.Proc] += 1
+	state.rmvd += 1
+	if i, ok := state.ownRequest(); ok && m.before((*state.reqs)[i]) {
+		state.prio += 1
+	}
+	state.sendNackMsg(m.Proc)
+}
+
+// Send a rejection of a stale request
+// Not threadsafe on its own: called only from processMessage
+func (state *LamportLockState) sendNackMsg(target int) {
+	// advance logical time
+	state.time += 1
+
+	// initialize nack message and send
+	r := Message{Type: MessageNack, Time: state.time, Proc: state.proc}
+	state.post(target, r)
+}
+
+// Record a rejection of our request by peer p
+// Like acks, nacks arrive in request order, so any due for retracted
+// requests are discarded.
+// Not threadsafe on its own: called only from processMessage
+func (state *LamportLockState) nackReceived(p int) {
+	if state.late[p] > 0 {
+		state.late[p] -= 1
+		return
+	}
+	if _, ok := state.ownRequest(); !ok {
+		return
+	}
+	// the peer has replied, so no ack is due from it
+	state.ackd[p] = true
+	state.nckd = true
+}
+
+// Check whether every live peer has acknowledged our request
+// With a TTL, a peer may reject our request rather than queue it, so we
+// cannot take the lock on the strength of later messages alone.
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) allAcked() bool {
+	for p, ok := range state.ackd {
+		if !ok && !state.gone[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// Check whether a peer has rejected our pending request (threadsafe)
+func (state *LamportLockState) nacked() bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.nckd
+}
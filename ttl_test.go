@@ -0,0 +1,53 @@
+package lamport
+
+import (
+	"errors"
+	"testing"
+)
+
+// Latest time each peer has seen from proc (threadsafe)
+func (state *LamportLockState) seenFrom(proc int) int {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.seen[proc]
+}
+
+// A request too old for a peer fails with ErrStale, without being granted,
+// and every process counts it as removed, so that the grants after it get
+// the tokens that follow it
+func TestStaleRequest(t *testing.T) {
+	ls := NewLocalCluster(3, WithMessageTTL(3), WithInvariants())
+	defer stopAll(ls)
+	if g := mustAcquire(t, ls[1]); g.Token() != 1 {
+		t.Fatalf("first grant got token %d", g.Token())
+	} else {
+		g.Release()
+	}
+
+	// as though 1's next request were stuck in transit while 2's clock
+	// moved on
+	ls[2].lock.Lock()
+	ls[2].time += 10
+	ls[2].lock.Unlock()
+	if g, err := ls[1].Acquire(); !errors.Is(err, ErrStale) {
+		if g != nil {
+			g.Release()
+		}
+		t.Fatalf("stale request returned %v, want ErrStale", err)
+	}
+
+	// once its retraction is everywhere, later requests follow it
+	ls[1].lock.Lock()
+	retracted := ls[1].time
+	ls[1].lock.Unlock()
+	waitFor(t, func() bool { return ls[0].seenFrom(1) >= retracted && ls[2].seenFrom(1) >= retracted })
+	want := 3
+	for _, l := range []*LamportLockState{ls[0], ls[2], ls[1]} {
+		g := mustAcquire(t, l)
+		if g.Token() != want {
+			t.Errorf("process %d granted token %d, want %d", l.proc, g.Token(), want)
+		}
+		want = g.Token() + 1
+		g.Release()
+	}
+}
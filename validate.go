@@ -0,0 +1,109 @@
+package lamport
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits on message payloads: inbound messages exceeding them are dropped
+// as malformed (see validate), and local requests or guarded values that
+// would exceed them are refused with ErrTooLarge, as peers would drop them
+const (
+	MaxSessionLen = 256     // Longest session name (see AcquireSession)
+	MaxMetaLen    = 4096    // Most bytes of request metadata, keys and values together
+	MaxAuthLen    = 64      // Longest eviction authentication (see ForceRelease)
+	MaxDataLen    = 1 << 20 // Longest guarded value, if a byte slice or string
+)
+
+// Returned when a request or guarded value exceeds the payload limits
+var ErrTooLarge = errors.New("lamport: payload too large")
+
+// Total size of request metadata, keys and values together
+func metaLen(meta map[string]string) int {
+	n := 0
+	for k, v := range meta {
+		n += len(k) + len(v)
+	}
+	return n
+}
+
+// Size of a guarded value, if it is a byte slice or string (other values
+// are not sized: they arrive in-process rather than decoded from a frame)
+func dataLen(data interface{}) int {
+	switch d := data.(type) {
+	case []byte:
+		return len(d)
+	case string:
+		return len(d)
+	}
+	return 0
+}
+
+// Check a request's session and metadata against the payload limits
+func checkRequest(session string, meta map[string]string) error {
+	if len(session) > MaxSessionLen || metaLen(meta) > MaxMetaLen {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// Check that an inbound message is well-formed, so that a corrupt or
+// malicious message (e.g. decoded by a transport interceptor) cannot crash
+// the service loop
+func (state *LamportLockState) validate(m Message) error {
+	if m.Type < 0 || m.Type >= messageTypes {
+		return fmt.Errorf("unknown type %d", m.Type)
+	}
+	if m.Proc < 0 || m.Proc >= len(state.chns) || m.Proc == state.proc {
+		return fmt.Errorf("bad origin %d (type %d)", m.Proc, m.Type)
+	}
+	if m.Time < 1 {
+		return fmt.Errorf("bad time %d from %d", m.Time, m.Proc)
+	}
+	if m.Type == MessageTransfer || m.Type == MessageEvict {
+		if m.Dest < 0 || m.Dest >= len(state.chns) {
+			return fmt.Errorf("bad target %d from %d", m.Dest, m.Proc)
+		}
+	}
+	if m.Type == MessageTransfer {
+		if r := m.Rqst; r == nil || r.Type != MessageRequest || r.Proc != m.Dest || r.Time < 1 ||
+			r.Time >= m.Time || checkRequest(r.Sess, r.Meta) != nil {
+			return fmt.Errorf("bad target request in transfer from %d", m.Proc)
+		}
+	}
+	if checkRequest(m.Sess, m.Meta) != nil || len(m.Auth) > MaxAuthLen || dataLen(m.Data) > MaxDataLen {
+		return fmt.Errorf("oversized payload (type %d) from %d", m.Type, m.Proc)
+	}
+	if m.Type == MessageState {
+		return state.validateJoinState(m)
+	}
+	return nil
+}
+
+// Check that a reply to our join describes the whole group, and that the
+// pending request it carries (if any) is the replier's own, made before it
+// replied
+func (state *LamportLockState) validateJoinState(m Message) error {
+	js, ok := m.Data.(joinState)
+	if !ok {
+		return fmt.Errorf("bad join state from %d", m.Proc)
+	}
+	if len(js.Gone) != len(state.chns) || len(js.Reqn) != len(state.chns) {
+		return fmt.Errorf("join state for %d/%d processes from %d", len(js.Gone), len(js.Reqn), m.Proc)
+	}
+	for _, n := range js.Reqn {
+		if n < 0 {
+			return fmt.Errorf("bad request count %d in join state from %d", n, m.Proc)
+		}
+	}
+	if js.Dtok < 0 || dataLen(js.Data) > MaxDataLen {
+		return fmt.Errorf("bad guarded value in join state from %d", m.Proc)
+	}
+	if p := js.Pend; p != nil {
+		if p.Type != MessageRequest || p.Proc != m.Proc || p.Time < 1 || p.Time >= m.Time ||
+			checkRequest(p.Sess, p.Meta) != nil {
+			return fmt.Errorf("bad pending request in join state from %d", m.Proc)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package lamport
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Start (or if rejoin, Rejoin) process 0 of a three-process cluster whose
+// peers never reply, draining their channels so that sends to them never
+// block
+func startAlone(t testing.TB, rejoin bool, opts ...Option) *LamportLockState {
+	chns := make([]chan Message, 3)
+	for p := range chns {
+		chns[p] = make(chan Message, LocalClusterBuffer)
+	}
+	done := make(chan struct{})
+	for _, c := range chns[1:] {
+		go func(c chan Message) {
+			for {
+				select {
+				case <-c:
+				case <-done:
+					return
+				}
+			}
+		}(c)
+	}
+	start := Start
+	if rejoin {
+		start = Rejoin
+	}
+	state := start(0, chns, opts...)
+	t.Cleanup(func() {
+		state.Stop()
+		close(done)
+	})
+	return state
+}
+
+// Requests and values that peers would drop as oversized are refused
+// locally, leaving the lock usable
+func TestTooLarge(t *testing.T) {
+	ls := NewLocalCluster(2)
+	defer stopAll(ls)
+
+	if _, err := ls[0].AcquireSession(strings.Repeat("s", MaxSessionLen+1)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("oversized session returned %v, want ErrTooLarge", err)
+	}
+	meta := map[string]string{"k": strings.Repeat("m", MaxMetaLen)}
+	if _, err := ls[0].AcquireWithMetadata(meta); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("oversized metadata returned %v, want ErrTooLarge", err)
+	}
+	v := NewGuardedValue[string](ls[0])
+	if err := v.Update(func(string) string { return strings.Repeat("d", MaxDataLen+1) }); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("oversized value returned %v, want ErrTooLarge", err)
+	}
+	if got, err := NewGuardedValue[string](ls[1]).Get(); err != nil || got != "" {
+		t.Errorf("Get() = %d bytes, %v; want none, nil", len(got), err)
+	}
+	mustAcquire(t, ls[1]).Release()
+}
+
+// Payloads at (index 0) and just over (index 1) the limits
+var (
+	fuzzSess = [2]string{strings.Repeat("s", MaxSessionLen), strings.Repeat("s", MaxSessionLen+1)}
+	fuzzMeta = [2]string{strings.Repeat("m", MaxMetaLen-1), strings.Repeat("m", MaxMetaLen)}
+	fuzzData = [2]string{strings.Repeat("d", MaxDataLen), strings.Repeat("d", MaxDataLen+1)}
+)
+
+// Decode fuzz input into messages, six bytes each, skewed towards small
+// values so that messages refer to real processes and to each other
+// The last byte carries a token, or a payload at or over the limits; for a
+// MessageState, the last two bytes describe its join state instead (see
+// decodeJoinState), and a MessageTransfer carries its target's request,
+// stamped just before it.
+func decodeMessages(data []byte) []Message {
+	var ms []Message
+	for ; len(data) >= 6; data = data[6:] {
+		m := Message{
+			Type: int(int8(data[0])) % (messageTypes + 1),
+			Proc: int(int8(data[1])) % 4,
+			Time: int(int16(binary.BigEndian.Uint16(data[2:4]))),
+			Dest: int(int8(data[4])) % 4,
+			Tokn: int(data[5] & 0x0f),
+			Incn: int64(data[5] >> 6),
+		}
+		over := data[5] & 1
+		switch data[5] & 0x30 {
+		case 0x10:
+			m.Sess = fuzzSess[over]
+		case 0x20:
+			m.Meta = map[string]string{"k": fuzzMeta[over]}
+		case 0x30:
+			m.Data = fuzzData[over]
+		}
+		if m.Type == MessageState {
+			m.Dest, m.Tokn = 0, 0
+			m.Data = decodeJoinState(m, data[4], data[5])
+		}
+		if m.Type == MessageTransfer {
+			m.Rqst = &Message{Type: MessageRequest, Proc: m.Dest, Time: m.Time - 1, Sess: m.Sess}
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+// Decode a join state with Gone and Reqn of up to four entries each (the
+// cluster has three processes) and, if flagged, a pending request from
+// any process, stamped at or before the reply
+func decodeJoinState(m Message, shape, fill byte) joinState {
+	js := joinState{
+		Gone: make([]bool, int(shape&7)%5),
+		Reqn: make([]int, int(shape>>3&7)%5),
+		Dtok: int(fill & 0x0f),
+	}
+	for i := range js.Gone {
+		js.Gone[i] = fill>>i&1 == 1
+	}
+	for i := range js.Reqn {
+		js.Reqn[i] = int(int8(fill)) + i
+	}
+	if shape&0x40 != 0 {
+		js.Pend = &Message{Type: MessageRequest, Proc: int(fill >> 6), Time: m.Time - 1}
+		if shape&0x80 != 0 {
+			js.Pend.Time = m.Time
+		}
+	}
+	return js
+}
+
+// Messages accepted by validate are safe to index by: their type names a
+// message, their origin is a peer and their target (if any) a process
+func FuzzValidate(f *testing.F) {
+	f.Add(MessageRequest, 1, 1, 0)
+	f.Add(MessageTransfer, 2, 5, 1)
+	f.Add(MessageEvict, 1, 3, -1)
+	f.Add(messageTypes, 1, 1, 0)
+	f.Add(MessageAck, 0, 1, 0)
+	state := startAlone(f, false)
+	f.Fuzz(func(t *testing.T, typ, proc, time, dest int) {
+		m := Message{Type: typ, Proc: proc, Time: time, Dest: dest}
+		if typ == MessageTransfer {
+			m.Rqst = &Message{Type: MessageRequest, Proc: dest, Time: time - 1}
+		}
+		if state.validate(m) != nil {
+			return
+		}
+		_ = messageNames[m.Type]
+		_ = state.chns[m.Proc]
+		if m.Proc == state.proc {
+			t.Errorf("accepted message from ourselves: %+v", m)
+		}
+		if m.Time < 1 {
+			t.Errorf("accepted message at time %d", m.Time)
+		}
+		if m.Type == MessageTransfer || m.Type == MessageEvict {
+			_ = state.chns[m.Dest]
+		}
+		if m.Type == MessageTransfer && m.Rqst.Time < 1 {
+			t.Errorf("accepted transfer of request at time %d", m.Rqst.Time)
+		}
+	})
+}
+
+// Servicing any sequence of messages that pass validate neither panics nor
+// breaks the state's invariants (see WithInvariants)
+func FuzzServiceMessages(f *testing.F) {
+	f.Add(false, []byte{
+		MessageRequest, 1, 0, 1, 0, 0,
+		MessageAck, 2, 0, 2, 0, 0,
+		MessageRelease, 1, 0, 3, 0, 1,
+	})
+	f.Add(false, []byte{
+		MessageRequest, 1, 0, 4, 0, 0,
+		MessageRequest, 1, 0, 2, 0, 0,
+		MessageTransfer, 1, 0, 5, 2, 1,
+		MessageRetract, 1, 0, 6, 0, 0,
+	})
+	f.Add(false, []byte{
+		MessageRequest, 2, 0, 1, 0, 0,
+		MessageDepart, 2, 0, 2, 0, 0,
+		MessageRequest, 2, 0, 3, 0, 0x40,
+	})
+	// a second request from the same process, its retract missed
+	f.Add(false, []byte{
+		MessageRequest, 1, 6, 7, 0, 0,
+		MessageRequest, 1, 3, 5, 0, 0,
+	})
+	// payloads at and over the limits
+	f.Add(false, []byte{
+		MessageRequest, 1, 0, 1, 0, 0x10,
+		MessageRequest, 2, 0, 2, 0, 0x11,
+		MessageRetract, 1, 0, 3, 0, 0x20,
+		MessageRequest, 1, 0, 4, 0, 0x21,
+		MessageRelease, 2, 0, 5, 0, 0x31,
+	})
+	// replies to our join: well-formed, with the replier's pending
+	// request; describing too many processes; with a pending request of
+	// another process, of ours, and stamped with the reply; with negative
+	// request counts
+	f.Add(true, []byte{MessageState, 1, 0, 5, 0x5b, 0x40})
+	f.Add(true, []byte{MessageState, 1, 0, 5, 0x24, 0x00})
+	f.Add(true, []byte{MessageState, 2, 0, 5, 0x5b, 0x00})
+	f.Add(true, []byte{MessageState, 1, 0, 5, 0x5b, 0x80})
+	f.Add(true, []byte{MessageState, 1, 0, 5, 0xdb, 0x40})
+	f.Add(true, []byte{MessageState, 1, 0, 5, 0x1b, 0xf0})
+	f.Fuzz(func(t *testing.T, rejoin bool, data []byte) {
+		state := startAlone(t, rejoin, WithInvariants())
+		var ms []Message
+		for _, m := range decodeMessages(data) {
+			if state.validate(m) == nil {
+				ms = append(ms, m)
+			}
+		}
+		// report a violation rather than hang in Stop on the lock it held
+		defer func() {
+			if r := recover(); r != nil {
+				state.lock.Unlock()
+				t.Fatal(r)
+			}
+		}()
+		state.serviceMessages(ms)
+	})
+}
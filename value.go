@@ -0,0 +1,89 @@
+package lamport
+
+// Attach the latest guarded value to an outgoing release or transfer,
+// versioned by the fencing token of the current grant
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) shipData(m *Message) {
+	if state.held != nil {
+		m.Tokn = state.held.token
+	}
+	m.Data = state.data
+}
+
+// Adopt the guarded value carried by a release or transfer, unless we
+// already have a newer one (releases from successive holders may arrive
+// out of order)
+// Not threadsafe on its own: called only within locked regions
+func (state *LamportLockState) recvData(m Message) {
+	if m.Tokn > state.dtok {
+		state.data = m.Data
+		state.dtok = m.Tokn
+	}
+}
+
+// Value replicated to whichever process currently holds the lock
+// Updates run under Acquire/Release, and the new value is shipped to all
+// peers with the release. Requires exclusive grants, i.e. the lock must not
+// be shared via WithHolders or AcquireSession.
+type GuardedValue[T any] struct {
+	state *LamportLockState
+}
+
+// Create a guarded value protected by the given lock
+// Each lock carries a single value, so all processes sharing the lock
+// should use the same type T (and only one GuardedValue per lock).
+func NewGuardedValue[T any](state *LamportLockState) *GuardedValue[T] {
+	return &GuardedValue[T]{state: state}
+}
+
+// Read the value as of the current holder (threadsafe)
+func (v *GuardedValue[T]) load() T {
+	v.state.lock.Lock()
+	defer v.state.lock.Unlock()
+	t, _ := v.state.data.(T)
+	return t
+}
+
+// Store a new value under the given grant, returning ErrNotHeld (and
+// storing nothing) if the grant has since ended, e.g. by eviction, or
+// ErrTooLarge if peers would drop the releases carrying it (see MaxDataLen)
+// (threadsafe)
+func (v *GuardedValue[T]) store(g *Guard, t T) error {
+	if dataLen(t) > MaxDataLen {
+		return ErrTooLarge
+	}
+	v.state.lock.Lock()
+	defer v.state.lock.Unlock()
+	if v.state.held != g {
+		return ErrNotHeld
+	}
+	v.state.data = t
+	v.state.dtok = g.token
+	return nil
+}
+
+// Replace the value with fn applied to it, under the lock
+// The zero value of T is used if no value has been set yet. The lock is
+// released however fn returns, including by panic (see WithLock); if the
+// lock is lost while fn runs, the value is left unchanged and ErrNotHeld
+// returned (or ErrTooLarge, if the new value exceeds MaxDataLen).
+func (v *GuardedValue[T]) Update(fn func(T) T) error {
+	g, err := v.state.Acquire()
+	if err != nil {
+		return err
+	}
+	return runLocked(g, func() error {
+		return v.store(g, fn(v.load()))
+	})
+}
+
+// Read the value, under the lock
+func (v *GuardedValue[T]) Get() (T, error) {
+	g, err := v.state.Acquire()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	t := v.load()
+	return t, g.Release()
+}
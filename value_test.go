@@ -0,0 +1,58 @@
+package lamport
+
+import (
+	"errors"
+	"testing"
+)
+
+// An update whose lock is lost before it stores is not shipped to peers
+func TestUpdateLostLock(t *testing.T) {
+	ls := NewLocalCluster(2, WithAdmin([]byte("secret"), nil))
+	defer stopAll(ls)
+	vs := []*GuardedValue[int]{NewGuardedValue[int](ls[0]), NewGuardedValue[int](ls[1])}
+
+	if err := vs[0].Update(func(int) int { return 1 }); err != nil {
+		t.Fatal(err)
+	}
+	err := vs[0].Update(func(cur int) int {
+		// evicted mid-update: wait for the loss to be noticed
+		ls[1].ForceRelease(0)
+		waitFor(t, func() bool { return !ls[0].haveLock() })
+		return 99
+	})
+	if !errors.Is(err, ErrNotHeld) {
+		t.Fatalf("update of lost lock returned %v, want ErrNotHeld", err)
+	}
+
+	// the next release from process 0 must not carry the failed update
+	g, err := ls[0].Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Release()
+	if got, err := vs[1].Get(); err != nil || got != 1 {
+		t.Errorf("Get() = %d, %v; want 1, nil", got, err)
+	}
+}
+
+// A panicking update releases the lock, leaving the value unchanged
+func TestUpdatePanic(t *testing.T) {
+	ls := NewLocalCluster(2)
+	defer stopAll(ls)
+	vs := []*GuardedValue[int]{NewGuardedValue[int](ls[0]), NewGuardedValue[int](ls[1])}
+
+	if err := vs[0].Update(func(int) int { return 1 }); err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic in update was not propagated")
+			}
+		}()
+		vs[0].Update(func(int) int { panic("boom") })
+	}()
+	if got, err := vs[1].Get(); err != nil || got != 1 {
+		t.Errorf("Get() = %d, %v; want 1, nil", got, err)
+	}
+}
@@ -0,0 +1,38 @@
+package lamport
+
+import (
+	"log"
+	"time"
+)
+
+// Report of a lock held for longer than the WithLongHold threshold
+type LongHold struct {
+	Proc  int           // Holding process
+	Token int           // Fencing token of the grant
+	Held  time.Duration // Time held so far
+	Stack []byte        // Stack trace of the goroutine that acquired the lock
+}
+
+// Report the current grant (once) if it has been held for too long
+// Not threadsafe on its own: called only from serviceMessages (within locked
+// region)
+func (state *LamportLockState) checkLongHold() {
+	g := state.held
+	if g == nil || g.warn || state.opts.longHold <= 0 {
+		return
+	}
+	held := state.opts.clock.Now().Sub(g.at)
+	if held < state.opts.longHold {
+		return
+	}
+	g.warn = true
+
+	r := LongHold{Proc: state.proc, Token: g.token, Held: held, Stack: g.stack}
+	log.Printf("lamport: process %d has held the lock for %v (token %d), acquired at:\n%s",
+		r.Proc, r.Held, r.Token, r.Stack)
+
+	// call back outside the locked region, in case fn uses the lock
+	if fn := state.opts.onLongHold; fn != nil {
+		go fn(r)
+	}
+}
@@ -0,0 +1,41 @@
+package lamport
+
+import (
+	"context"
+	"time"
+)
+
+// Acquire the distributed lock, run fn and release the lock
+// The lock is released however fn returns, including by panic (which then
+// continues). Returns the error from acquisition, else from fn, else from
+// the release (e.g. ErrNotHeld if the lock was lost while fn ran).
+func (state *LamportLockState) WithLock(ctx context.Context, fn func() error) error {
+	g, err := state.AcquireContext(ctx)
+	if err != nil {
+		return err
+	}
+	return runLocked(g, fn)
+}
+
+// Run fn under the distributed lock, as with WithLock, giving up on the
+// acquisition after d (with context.DeadlineExceeded)
+// The timeout bounds only the wait for the lock, not fn.
+func (state *LamportLockState) WithLockTimeout(d time.Duration, fn func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	g, err := state.AcquireContext(ctx)
+	if err != nil {
+		return err
+	}
+	return runLocked(g, fn)
+}
+
+// Run fn, then release g whether or not fn panics
+func runLocked(g *Guard, fn func() error) (err error) {
+	defer func() {
+		if rerr := g.Release(); err == nil {
+			err = rerr
+		}
+	}()
+	return fn()
+}